@@ -2,15 +2,22 @@ package list
 
 import (
 	"encoding/csv"
-	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/cli/go-gh/v2/pkg/api"
 	"github.com/cli/go-gh/v2/pkg/auth"
+	"github.com/cli/go-gh/v2/pkg/term"
 	"github.com/katiem0/gh-branch-rules/internal/data"
 	"github.com/katiem0/gh-branch-rules/internal/log"
 	"github.com/katiem0/gh-branch-rules/internal/utils"
@@ -19,10 +26,42 @@ import (
 )
 
 type cmdFlags struct {
-	token    string
-	hostname string
-	listFile string
-	debug    bool
+	token           string
+	hostname        string
+	maxRetries      int
+	listFile        string
+	concurrency     int
+	batch           int
+	lint            bool
+	fix             bool
+	continueOnError bool
+	errorsFile      string
+	checkpointFile  string
+	resume          bool
+	visibility      string
+	excludeArchived bool
+	excludeForks    bool
+	topics          []string
+	language        string
+	nameRegex       string
+	pushedSince     string
+	properties      []string
+	withProperties  bool
+	team            string
+	teamPermission  string
+	owningTeams     bool
+	reposFile       string
+	enterprise      string
+	orgs            []string
+	columns         []string
+	jsonFields      []string
+	format          string
+	force           bool
+	appendReport    bool
+	jqExpr          string
+	template        string
+	orgsFile        string
+	debug           bool
 }
 
 func NewCmdList() *cobra.Command {
@@ -30,21 +69,19 @@ func NewCmdList() *cobra.Command {
 	var authToken string
 
 	listCmd := &cobra.Command{
-		Use:   "list [flags] <organization> [repo ...]",
+		Use:   "list [flags] <owner> [repo ...]",
 		Short: "Generate a report of branch protection rules for repositories.",
 		Long:  "Generate a report of branch protection rules for a list of repositories",
-		Args:  cobra.MinimumNArgs(1),
+		Args:  cobra.ArbitraryArgs,
 		RunE: func(listCmd *cobra.Command, args []string) error {
 			var err error
 			var gqlClient *api.GraphQLClient
 			var restClient *api.RESTClient
 
-			// Reinitialize logging if debugging was enabled
-			if cmdFlags.debug {
-				logger, _ := log.NewLogger(cmdFlags.debug)
-				defer logger.Sync() // nolint:errcheck
-				zap.ReplaceGlobals(logger)
-			}
+			// Reinitialize logging, including debug logging if it was enabled
+			logger, _ := log.NewLogger(cmdFlags.debug)
+			defer logger.Sync() // nolint:errcheck
+			zap.ReplaceGlobals(logger)
 
 			if cmdFlags.token != "" {
 				authToken = cmdFlags.token
@@ -53,12 +90,15 @@ func NewCmdList() *cobra.Command {
 				authToken = t
 			}
 
+			rateLimiter := utils.NewRateLimiter()
+
 			restClient, err = api.NewRESTClient(api.ClientOptions{
 				Headers: map[string]string{
 					"Accept": "application/vnd.github+json",
 				},
 				Host:      cmdFlags.hostname,
 				AuthToken: authToken,
+				Transport: rateLimiter.RoundTripper(http.DefaultTransport),
 			})
 
 			if err != nil {
@@ -72,6 +112,7 @@ func NewCmdList() *cobra.Command {
 				},
 				Host:      cmdFlags.hostname,
 				AuthToken: authToken,
+				Transport: rateLimiter.RoundTripper(http.DefaultTransport),
 			})
 
 			if err != nil {
@@ -79,158 +120,909 @@ func NewCmdList() *cobra.Command {
 				return err
 			}
 
-			owner := args[0]
-			repos := args[1:]
+			orgs := cmdFlags.orgs
+			if cmdFlags.orgsFile != "" {
+				fileOrgs, err := utils.ReadOrgsFile(cmdFlags.orgsFile)
+				if err != nil {
+					zap.S().Errorf("Error arose reading organizations from %s", cmdFlags.orgsFile)
+					return err
+				}
+				orgs = append(orgs, fileOrgs...)
+			}
+
+			// target is the owner, owners or enterprise being listed
+			var target string
+			var owners, repos []string
+			switch {
+			case cmdFlags.enterprise != "":
+				if len(args) > 0 || len(orgs) > 0 || cmdFlags.reposFile != "" || cmdFlags.team != "" {
+					return fmt.Errorf("--enterprise lists every organization in the enterprise, and cannot be combined with an owner, --org, --orgs-file, named repositories, --repos-file or --team")
+				}
+				target = cmdFlags.enterprise
+			case len(orgs) > 0:
+				if len(args) > 0 || cmdFlags.reposFile != "" || cmdFlags.team != "" {
+					return fmt.Errorf("--org and --orgs-file cannot be combined with an owner, named repositories, --repos-file or --team")
+				}
+				seen := make(map[string]bool, len(orgs))
+				for _, org := range orgs {
+					if !seen[strings.ToLower(org)] {
+						seen[strings.ToLower(org)] = true
+						owners = append(owners, org)
+					}
+				}
+				target = strings.Join(owners, ",")
+			default:
+				if len(args) == 0 {
+					return fmt.Errorf("requires an owner, --org or --enterprise")
+				}
+				target = args[0]
+				owners = args[:1]
+				repos = args[1:]
+			}
 
-			if _, err := os.Stat(cmdFlags.listFile); errors.Is(err, os.ErrExist) {
-				return err
+			if cmdFlags.reposFile != "" {
+				fileRepos, err := utils.ReadReposFile(cmdFlags.reposFile, target)
+				if err != nil {
+					zap.S().Errorf("Error arose reading repositories from %s", cmdFlags.reposFile)
+					return err
+				}
+				for _, fullName := range fileRepos {
+					repoOwner, repo, _ := strings.Cut(fullName, "/")
+					if !strings.EqualFold(repoOwner, target) {
+						return fmt.Errorf("%s in %s is not in %s", fullName, cmdFlags.reposFile, target)
+					}
+					repos = append(repos, repo)
+				}
+			}
+			// Repositories named both on the command line and in the file,
+			// or more than once on the command line, are listed once
+			seenRepos := make(map[string]bool, len(repos))
+			var uniqueRepos []string
+			for _, repo := range repos {
+				if !seenRepos[strings.ToLower(repo)] {
+					seenRepos[strings.ToLower(repo)] = true
+					uniqueRepos = append(uniqueRepos, repo)
+				}
+			}
+			repos = uniqueRepos
+
+			if cmdFlags.maxRetries < 0 {
+				return fmt.Errorf("--max-retries must not be negative, got %d", cmdFlags.maxRetries)
 			}
 
-			reportWriter, err := os.OpenFile(cmdFlags.listFile, os.O_WRONLY|os.O_CREATE, 0644)
+			if cmdFlags.concurrency < 1 {
+				return fmt.Errorf("--concurrency must be at least 1, got %d", cmdFlags.concurrency)
+			}
+
+			if cmdFlags.batch < 0 || cmdFlags.batch > 100 {
+				return fmt.Errorf("--batch must be between 0 and 100, got %d", cmdFlags.batch)
+			}
 
+			if cmdFlags.fix {
+				cmdFlags.lint = true
+			}
+
+			filter := utils.RepoFilter{
+				Visibility:      cmdFlags.visibility,
+				ExcludeArchived: cmdFlags.excludeArchived,
+				ExcludeForks:    cmdFlags.excludeForks,
+				Topics:          cmdFlags.topics,
+				Language:        cmdFlags.language,
+			}
+			switch strings.ToLower(cmdFlags.visibility) {
+			case "", "public", "private", "internal":
+			default:
+				return fmt.Errorf("--visibility must be one of public, private or internal, got %q", cmdFlags.visibility)
+			}
+			if cmdFlags.team != "" {
+				if len(repos) > 0 {
+					return fmt.Errorf("--team cannot be combined with named repositories")
+				}
+				if cmdFlags.batch > 0 {
+					return fmt.Errorf("--batch cannot be combined with --team")
+				}
+			}
+			if cmdFlags.teamPermission != "" {
+				if cmdFlags.team == "" {
+					return fmt.Errorf("--team-permission requires --team")
+				}
+				cmdFlags.teamPermission, err = utils.ParseTeamPermission(cmdFlags.teamPermission)
+				if err != nil {
+					return err
+				}
+			}
+
+			propertyFilters, err := utils.ParsePropertyFilters(cmdFlags.properties)
 			if err != nil {
 				return err
 			}
+			if cmdFlags.jqExpr != "" || cmdFlags.template != "" {
+				if len(cmdFlags.jsonFields) == 0 {
+					return fmt.Errorf("--jq and --template require --json")
+				}
+				if cmdFlags.jqExpr != "" && cmdFlags.template != "" {
+					return fmt.Errorf("--jq and --template cannot be combined")
+				}
+				if err := utils.CheckJSONFormat(cmdFlags.jqExpr, cmdFlags.template); err != nil {
+					return err
+				}
+			}
+			switch cmdFlags.format {
+			case "csv":
+			case "table":
+				// Tables are for reading in the terminal, so hold fewer
+				// columns unless others are asked for
+				if !listCmd.Flags().Changed("output-file") {
+					cmdFlags.listFile = "-"
+				}
+				if len(cmdFlags.columns) == 0 {
+					cmdFlags.columns = tableColumns
+				}
+			default:
+				return fmt.Errorf("--format must be csv or table, got %q", cmdFlags.format)
+			}
+			if len(cmdFlags.jsonFields) > 0 {
+				if listCmd.Flags().Changed("columns") || listCmd.Flags().Changed("output-file") || listCmd.Flags().Changed("format") || cmdFlags.checkpointFile != "" {
+					return fmt.Errorf("--json writes to stdout, and cannot be combined with --columns, --output-file, --format or --checkpoint")
+				}
+				cmdFlags.jsonFields, err = utils.ParseJSONFields(cmdFlags.jsonFields)
+				if err != nil {
+					return err
+				}
+				// Fields outside the rule and metadata columns turn on the
+				// options that add them to the report
+				for _, field := range cmdFlags.jsonFields {
+					switch {
+					case field == "Organization":
+					case field == "OwningTeams":
+						cmdFlags.owningTeams = true
+					case strings.HasPrefix(field, utils.PropertyColumnPrefix):
+						cmdFlags.withProperties = true
+					default:
+						cmdFlags.columns = append(cmdFlags.columns, field)
+					}
+				}
+			}
+			cmdFlags.columns, err = utils.ParseReportColumns(cmdFlags.columns)
+			if err != nil {
+				return fmt.Errorf("invalid --columns: %w", err)
+			}
+			if cmdFlags.nameRegex != "" {
+				filter.NameRegex, err = regexp.Compile(cmdFlags.nameRegex)
+				if err != nil {
+					return fmt.Errorf("invalid --name-regex: %w", err)
+				}
+			}
+			if cmdFlags.pushedSince != "" {
+				filter.PushedSince, err = time.Parse("2006-01-02", cmdFlags.pushedSince)
+				if err != nil {
+					filter.PushedSince, err = time.Parse(time.RFC3339, cmdFlags.pushedSince)
+				}
+				if err != nil {
+					return fmt.Errorf("--pushed-since must be a date such as 2024-01-31 or an RFC 3339 time, got %q", cmdFlags.pushedSince)
+				}
+			}
+
+			if cmdFlags.checkpointFile != "" && cmdFlags.listFile == "-" {
+				return fmt.Errorf("--checkpoint cannot be used when writing to stdout")
+			}
+			if cmdFlags.checkpointFile != "" && cmdFlags.format == "table" {
+				// A resumed table would take its first row for the header
+				return fmt.Errorf("--checkpoint cannot be used with --format table")
+			}
+			if cmdFlags.force && cmdFlags.appendReport {
+				return fmt.Errorf("--force and --append cannot be combined")
+			}
+			if (cmdFlags.force || cmdFlags.appendReport) && (cmdFlags.listFile == "-" || len(cmdFlags.jsonFields) > 0) {
+				return fmt.Errorf("--force and --append only apply to reports written to a file")
+			}
+			if cmdFlags.appendReport && cmdFlags.format != "csv" {
+				return fmt.Errorf("--append only applies to csv reports")
+			}
+			var checkpoint *utils.Checkpoint
+			if cmdFlags.resume {
+				if cmdFlags.force {
+					return fmt.Errorf("--force cannot be combined with --resume, which appends to the report")
+				}
+				if cmdFlags.checkpointFile == "" {
+					return fmt.Errorf("--resume requires --checkpoint")
+				}
+				checkpoint, err = utils.LoadCheckpoint(cmdFlags.checkpointFile)
+				if err != nil {
+					zap.S().Errorf("Error arose reading checkpoint file %s", cmdFlags.checkpointFile)
+					return err
+				}
+				if checkpoint.Owner != target {
+					return fmt.Errorf("checkpoint %s was recorded for %s, not %s", cmdFlags.checkpointFile, checkpoint.Owner, target)
+				}
+				if !listCmd.Flags().Changed("output-file") {
+					cmdFlags.listFile = checkpoint.OutputFile
+				}
+			} else if cmdFlags.checkpointFile != "" {
+				checkpoint = utils.NewCheckpoint(cmdFlags.checkpointFile, target, cmdFlags.listFile)
+			}
+
+			// An existing report is only replaced or added to when asked
+			if !cmdFlags.resume && !cmdFlags.force && !cmdFlags.appendReport && cmdFlags.listFile != "-" && len(cmdFlags.jsonFields) == 0 {
+				if _, err := os.Stat(cmdFlags.listFile); err == nil {
+					return fmt.Errorf("%s already exists, use --force to overwrite it or --append to add to it", cmdFlags.listFile)
+				}
+			}
 
-			return runCmdList(owner, repos, &cmdFlags, utils.NewAPIGetter(gqlClient, restClient), reportWriter)
+			g := utils.NewAPIGetter(gqlClient, restClient, rateLimiter, cmdFlags.maxRetries)
+			if cmdFlags.enterprise != "" {
+				owners, err = g.GetEnterpriseOrgs(cmdFlags.enterprise)
+				if err != nil {
+					zap.S().Errorf("Error arose retrieving organizations of enterprise %s", cmdFlags.enterprise)
+					return err
+				}
+				if len(owners) == 0 {
+					return fmt.Errorf("no organizations found in enterprise %s", cmdFlags.enterprise)
+				}
+			}
+
+			// JSON and tables are only written once every rule has been gathered
+			var report utils.RecordWriter
+			var render func() error
+			var reportFile *utils.ReportFile
+			if len(cmdFlags.jsonFields) > 0 {
+				jsonWriter := utils.NewJSONWriter(os.Stdout, cmdFlags.jsonFields, cmdFlags.jqExpr, cmdFlags.template)
+				report, render = jsonWriter, jsonWriter.Close
+			} else {
+				reportWriter := io.Writer(os.Stdout)
+				if cmdFlags.listFile != "-" {
+					// Checkpointed reports are written in place, so that
+					// they can be resumed
+					reportFile, err = utils.OpenReportFile(cmdFlags.listFile, cmdFlags.appendReport || cmdFlags.resume, checkpoint != nil)
+					if err != nil {
+						return err
+					}
+					reportWriter = reportFile
+				}
+				if cmdFlags.format == "table" {
+					tableWriter := utils.NewTableWriter(reportWriter, cmdFlags.listFile == "-" && term.FromEnv().IsTerminalOutput())
+					report, render = tableWriter, tableWriter.Close
+				} else if checkpoint != nil {
+					report = utils.NewBufferedCSVWriter(reportWriter)
+				} else {
+					report = csv.NewWriter(reportWriter)
+				}
+			}
+
+			// Reports written through a temporary file keep the rows
+			// written so far if the run is interrupted
+			if reportFile != nil {
+				interrupts := make(chan os.Signal, 1)
+				signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+				done := make(chan struct{})
+				defer func() {
+					signal.Stop(interrupts)
+					close(done)
+				}()
+				go func() {
+					select {
+					case <-interrupts:
+						keepPartialReport(reportFile)
+						os.Exit(130)
+					case <-done:
+					}
+				}()
+			}
+
+			err = runCmdList(target, owners, repos, &cmdFlags, filter, propertyFilters, g, report, checkpoint)
+			if err == nil && render != nil {
+				err = render()
+			}
+			if reportFile == nil {
+				return err
+			}
+			if err != nil {
+				// Rows gathered before the failure are written out so
+				// that they can be kept
+				report.Flush()
+				if render != nil {
+					render() // nolint:errcheck
+				}
+				keepPartialReport(reportFile)
+				return err
+			}
+			return reportFile.Commit()
 		},
 	}
 
 	reportFileDefault := fmt.Sprintf("BranchRules-%s.csv", time.Now().Format("20060102150405"))
+	errorsFileDefault := fmt.Sprintf("BranchRulesErrors-%s.csv", time.Now().Format("20060102150405"))
 
 	// Configure flags for command
 
 	listCmd.PersistentFlags().StringVarP(&cmdFlags.token, "token", "t", "", `GitHub Personal Access Token (default "gh auth token")`)
 	listCmd.PersistentFlags().StringVarP(&cmdFlags.hostname, "hostname", "", "github.com", "GitHub Enterprise Server hostname")
-	listCmd.Flags().StringVarP(&cmdFlags.listFile, "output-file", "o", reportFileDefault, "Name of file to write CSV list to")
+	listCmd.PersistentFlags().IntVar(&cmdFlags.maxRetries, "max-retries", 3, "Maximum number of times to retry a request after a transient error")
+	listCmd.Flags().StringVarP(&cmdFlags.listFile, "output-file", "o", reportFileDefault, "Name of file to write CSV list to, or - for stdout")
+	listCmd.Flags().BoolVar(&cmdFlags.force, "force", false, "Overwrite --output-file if it already exists")
+	listCmd.Flags().BoolVar(&cmdFlags.appendReport, "append", false, "Add rows to --output-file if it already exists, without repeating the header")
+	listCmd.Flags().IntVar(&cmdFlags.concurrency, "concurrency", 1, "Number of repositories to gather branch protection rules for in parallel")
+	listCmd.Flags().IntVar(&cmdFlags.batch, "batch", 0, "Number of branch protection rules to request with each page of repositories, up to 100 (0 queries each repository separately)")
+	listCmd.Flags().BoolVar(&cmdFlags.lint, "lint", false, "Report contradictory or ineffective settings on each rule")
+	listCmd.Flags().BoolVar(&cmdFlags.fix, "fix", false, "Write normalized settings to the report (implies --lint)")
+	listCmd.Flags().BoolVar(&cmdFlags.continueOnError, "continue-on-error", false, "Record repositories that fail and continue listing the rest")
+	listCmd.Flags().StringVar(&cmdFlags.errorsFile, "errors-file", errorsFileDefault, "Name of file to record failed repositories to with --continue-on-error, as JSON if it ends in .json and CSV otherwise")
+	listCmd.Flags().StringVar(&cmdFlags.checkpointFile, "checkpoint", "", "Name of file to record progress to so that an interrupted run can be resumed")
+	listCmd.Flags().BoolVar(&cmdFlags.resume, "resume", false, "Resume the run recorded in --checkpoint, appending to its report")
+	listCmd.Flags().StringVar(&cmdFlags.visibility, "visibility", "", "Only list repositories with this visibility: public, private or internal")
+	listCmd.Flags().BoolVar(&cmdFlags.excludeArchived, "exclude-archived", false, "Skip archived repositories")
+	listCmd.Flags().BoolVar(&cmdFlags.excludeForks, "exclude-forks", false, "Skip forked repositories")
+	listCmd.Flags().StringSliceVar(&cmdFlags.topics, "topic", nil, "Only list repositories with this topic, may be repeated to require several")
+	listCmd.Flags().StringVar(&cmdFlags.language, "language", "", "Only list repositories with this primary language")
+	listCmd.Flags().StringVar(&cmdFlags.nameRegex, "name-regex", "", "Only list repositories whose name matches this regular expression")
+	listCmd.Flags().StringVar(&cmdFlags.pushedSince, "pushed-since", "", "Only list repositories pushed to on or after this date (YYYY-MM-DD or RFC 3339)")
+	listCmd.Flags().StringSliceVar(&cmdFlags.columns, "columns", nil, fmt.Sprintf("Write only these columns to the report, in this order, comma separated (default all rule columns), adding any of the repository metadata columns %s", strings.Join(utils.MetadataColumns, ", ")))
+	listCmd.Flags().StringVar(&cmdFlags.format, "format", "csv", "Format of the report: csv, or table to print an aligned table to stdout")
+	listCmd.Flags().StringSliceVar(&cmdFlags.jsonFields, "json", nil, "Write JSON with these fields to stdout instead of a CSV report, comma separated, any of the --columns as well as Organization, OwningTeams and Property.<name>")
+	listCmd.Flags().StringVarP(&cmdFlags.jqExpr, "jq", "q", "", "Filter JSON output using a jq expression")
+	listCmd.Flags().StringVar(&cmdFlags.template, "template", "", "Format JSON output using a Go template")
+	listCmd.Flags().StringArrayVar(&cmdFlags.properties, "property", nil, "Only list repositories with this custom property value, as key=value, may be repeated to require several")
+	listCmd.Flags().BoolVar(&cmdFlags.withProperties, "properties", false, "Add a column for each custom property of the organization (implied by --property)")
+	listCmd.Flags().StringVar(&cmdFlags.enterprise, "enterprise", "", "List every organization in the enterprise with this slug into one report, with an Organization column")
+	listCmd.Flags().StringArrayVar(&cmdFlags.orgs, "org", nil, "List this organization into one report with others, with an Organization column, may be repeated")
+	listCmd.Flags().StringVar(&cmdFlags.orgsFile, "orgs-file", "", "Name of file to read organizations to list from, one per line (- for stdin), as with --org")
+	listCmd.Flags().StringVar(&cmdFlags.reposFile, "repos-file", "", "Name of file to read repositories to list from, one repo or owner/repo per line (- for stdin)")
+	listCmd.Flags().StringVar(&cmdFlags.team, "team", "", "Only list repositories the team with this slug has access to (adds the OwningTeams column)")
+	listCmd.Flags().StringVar(&cmdFlags.teamPermission, "team-permission", "", "Only list repositories on which --team has at least this permission: read, triage, write, maintain or admin")
+	listCmd.Flags().BoolVar(&cmdFlags.owningTeams, "owning-teams", false, "Add an OwningTeams column with the teams that have admin permission on each repository (implied by --team)")
 	listCmd.PersistentFlags().BoolVarP(&cmdFlags.debug, "debug", "d", false, "To debug logging")
 
 	return listCmd
 }
 
-func runCmdList(owner string, repos []string, cmdFlags *cmdFlags, g *utils.APIGetter, reportWriter io.Writer) error {
-	var reposCursor *string
-	var allRepos []data.RepoInfo
-	zap.S().Infof("Gathering repositories in %s to list branch protection policies", owner)
-	csvWriter := csv.NewWriter(reportWriter)
-
-	err := csvWriter.Write([]string{
-		"RepositoryName",
-		"RepositoryID",
-		"BranchProtectionRulePattern",
-		"BranchProtectionRuleId",
-		"AllowsDeletions",
-		"AllowsForcePushes",
-		"BlockCreations",
-		"DismissesStaleReviews",
-		"IsAdminEnforced",
-		"LockAllowsFetchAndMerge",
-		"LockBranch",
-		"RequireLastPushApproval",
-		"RequiredApprovingReviewCount",
-		"RequiresApprovingReviews",
-		"RequiresCodeOwnerReviews",
-		"RequiresCommitSignatures",
-		"RequiresConversationResolution",
-		"RequiresDeployments",
-		"RequiresLinearHistory",
-		"RequiresStatusChecks",
-		"RequiresStrictStatusChecks",
-		"RestrictsPushes",
-		"RestrictsReviewDismissals",
-	})
+func runCmdList(target string, owners []string, repos []string, cmdFlags *cmdFlags, filter utils.RepoFilter, propertyFilters map[string]string, g *utils.APIGetter, report utils.RecordWriter, checkpoint *utils.Checkpoint) error {
+	zap.S().Infof("Gathering repositories in %s to list branch protection policies", target)
+	run := &listRun{
+		cmdFlags:         cmdFlags,
+		filter:           filter,
+		propertyFilters:  propertyFilters,
+		g:                g,
+		report:           report,
+		checkpoint:       checkpoint,
+		withOrganization: cmdFlags.enterprise != "" || len(cmdFlags.orgs) > 0 || cmdFlags.orgsFile != "" || slices.Contains(cmdFlags.jsonFields, "Organization"),
+	}
+	withProperties := cmdFlags.withProperties || len(propertyFilters) > 0
+	withOwningTeams := cmdFlags.owningTeams || cmdFlags.team != ""
 
-	if err != nil {
-		return err
+	// Owners of an enterprise are always organizations
+	if cmdFlags.enterprise == "" {
+		for _, owner := range owners {
+			ownerType, err := g.GetOwnerType(owner)
+			if err != nil {
+				zap.S().Errorf("Error arose looking up %s", owner)
+				return err
+			}
+			zap.S().Debugf("%s is a %s", owner, ownerType)
+			if ownerType != "Organization" && (withProperties || withOwningTeams) {
+				return fmt.Errorf("%s is a user, --team, --owning-teams, --property and --properties are only available for organizations", owner)
+			}
+		}
 	}
-	zap.S().Infof("Gathering repositories and branch protection rules")
 
-	if len(repos) > 0 {
-		zap.S().Infof("Processing repos: %s", repos)
+	// Custom property values are gathered for every owner up front, so that
+	// the report has a column for each property of any of them
+	ownerProperties := make(map[string]utils.RepoProperties, len(owners))
+	if withProperties {
+		seen := make(map[string]bool)
+		for _, owner := range owners {
+			zap.S().Debugf("Gathering custom property values for %s", owner)
+			allValues, err := g.GetRepoProperties(owner)
+			if err != nil {
+				zap.S().Errorf("Error arose retrieving custom property values for %s", owner)
+				return err
+			}
+			ownerProperties[owner] = utils.NewRepoProperties(allValues)
+			for _, name := range ownerProperties[owner].Names() {
+				if !seen[name] {
+					seen[name] = true
+					run.propertyNames = append(run.propertyNames, name)
+				}
+			}
+		}
+		sort.Strings(run.propertyNames)
+	}
 
-		for _, repo := range repos {
+	header := cmdFlags.columns
+	if run.withOrganization {
+		header = append([]string{"Organization"}, header...)
+	}
+	if withOwningTeams {
+		header = append(append([]string{}, header...), "OwningTeams")
+	}
+	header = append(append([]string{}, header...), propertyColumns(run.propertyNames)...)
+
+	// A resumed run appends to a report that already has a header, as may a
+	// report being appended to, which must have the same columns
+	writeHeader := true
+	if cmdFlags.appendReport || cmdFlags.resume {
+		existing, err := utils.ReadReportHeader(cmdFlags.listFile)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			if !slices.Equal(existing, header) {
+				if cmdFlags.resume {
+					return fmt.Errorf("%s has different columns to this report, resume with the options of the interrupted run", cmdFlags.listFile)
+				}
+				return fmt.Errorf("%s has different columns to this report, and cannot be appended to", cmdFlags.listFile)
+			}
+			writeHeader = false
+		}
+	}
+	if writeHeader {
+		err := run.report.Write(header)
 
-			zap.S().Debugf("Processing %s/%s", owner, repo)
+		if err != nil {
+			return err
+		}
+		// The header is flushed on its own so that a run interrupted
+		// before its first repository still resumes under it
+		run.report.Flush()
+		if err := run.report.Error(); err != nil {
+			return err
+		}
+	}
+	var reposCursor *string
+	if cmdFlags.resume {
+		reposCursor = checkpoint.Cursor
+	}
+	zap.S().Infof("Gathering repositories and branch protection rules")
 
-			repoQuery, err := g.GetRepo(owner, repo)
+	for _, owner := range owners {
+		if checkpoint.IsOrganizationCompleted(owner) {
+			zap.S().Debugf("Skipping %s, already listed", owner)
+			continue
+		}
+		run.owner = owner
+		run.properties = ownerProperties[owner]
+		if withOwningTeams {
+			zap.S().Debugf("Gathering teams with admin permission on repositories in %s", owner)
+			owningTeams, err := g.GetOwningTeams(owner)
 			if err != nil {
+				zap.S().Errorf("Error arose retrieving teams for %s", owner)
 				return err
 			}
-			allRepos = append(allRepos, repoQuery.Repository)
+			run.owningTeams = owningTeams
 		}
 
-	} else {
-		// Prepare writer for outputting report
-		for {
-			zap.S().Debugf("Processing list of repositories for %s", owner)
-			reposQuery, err := g.GetReposList(owner, reposCursor)
+		if err := run.listOwner(repos, reposCursor); err != nil {
+			return err
+		}
+		if err := checkpoint.CompleteOrganization(owner); err != nil {
+			return err
+		}
+		reposCursor = nil
+	}
 
-			if err != nil {
+	if cmdFlags.lint {
+		if cmdFlags.fix {
+			fmt.Fprintf(os.Stderr, "Normalized %d contradictory or ineffective setting(s) in the report\n", run.lintCount)
+		} else {
+			fmt.Fprintf(os.Stderr, "Found %d contradictory or ineffective setting(s)\n", run.lintCount)
+		}
+	}
+
+	// Messages are kept apart from a report written to stdout on stderr
+	messages := io.Writer(os.Stdout)
+	if len(cmdFlags.jsonFields) > 0 || cmdFlags.listFile == "-" {
+		messages = os.Stderr
+	}
+
+	if err := checkpoint.Remove(); err != nil {
+		zap.S().Warnf("Unable to remove checkpoint file: %v", err)
+	}
+
+	if len(run.repoErrors) > 0 {
+		if err := utils.WriteRepoErrors(cmdFlags.errorsFile, run.repoErrors); err != nil {
+			zap.S().Errorf("Error arose writing repository errors to %s", cmdFlags.errorsFile)
+			return err
+		}
+		fmt.Fprintf(messages, "Listed repository level branch protection policies for %s, %d repositories failed and are recorded in %s\n", target, len(run.repoErrors), cmdFlags.errorsFile)
+		return nil
+	}
+	fmt.Fprintf(messages, "Successfully listed repository level branch protection policies for %s\n", target)
+
+	return nil
+}
+
+// listOwner writes the rules of the owner's repositories to the report,
+// starting after reposCursor when it is set.
+func (run *listRun) listOwner(repos []string, reposCursor *string) error {
+	// The next page of repositories is fetched while the previous page's
+	// rules are gathered and written, and waits to be sent until that page is
+	// done, so at most two pages are held in memory at a time
+	done := make(chan struct{})
+	defer close(done)
+	for page := range run.fetchPages(repos, reposCursor, done) {
+		if page.err != nil {
+			// An organization that cannot be listed does not stop the rest of
+			// an enterprise
+			if run.withOrganization && run.cmdFlags.continueOnError {
+				run.repoErrors = append(run.repoErrors, utils.NewRepoError(run.owner, "getRepos", page.err))
+				return nil
+			}
+			return page.err
+		}
+
+		if err := run.writePage(page.items); err != nil {
+			return err
+		}
+
+		if page.endCursor != nil {
+			if err := run.checkpoint.NextPage(*page.endCursor); err != nil {
 				return err
 			}
+		}
+	}
+	return nil
+}
+
+// listRun holds the state of a list run shared across owners and pages of
+// repositories. Only the goroutine running writePage updates it.
+type listRun struct {
+	owner      string
+	cmdFlags   *cmdFlags
+	filter     utils.RepoFilter
+	g          *utils.APIGetter
+	report     utils.RecordWriter
+	checkpoint *utils.Checkpoint
+	repoErrors []utils.RepoError
+	lintCount  int
+	// owningTeams holds the teams with admin permission on each of the
+	// owner's repositories when they are written to the report
+	owningTeams map[string][]string
+	// properties holds the owner's custom property values when they are
+	// selected on or written to the report, with a column for each of
+	// propertyNames
+	properties      utils.RepoProperties
+	propertyNames   []string
+	propertyFilters map[string]string
+	// withOrganization is set when owners are listed with --org, --orgs-file
+	// or --enterprise, and each row starts with its owner
+	withOrganization bool
+}
 
-			allRepos = append(allRepos, reposQuery.Organization.Repositories.Nodes...)
+// repoPage is a page of repositories to list. endCursor is nil for
+// repositories named on the command line.
+type repoPage struct {
+	items     []repoItem
+	endCursor *string
+	err       error
+}
 
-			reposCursor = &reposQuery.Organization.Repositories.PageInfo.EndCursor
+// repoItem is a repository whose rules are to be written to the report.
+type repoItem struct {
+	repo data.RepoInfo
+	// lookup is set for repositories named on the command line, which are
+	// looked up before their rules are gathered
+	lookup bool
+	// policies holds any rules gathered along with the page of repositories,
+	// and fetch is set when more remain to be gathered after cursor
+	policies []data.BranchProtectionRule
+	fetch    bool
+	cursor   *string
+}
 
-			if !reposQuery.Organization.Repositories.PageInfo.HasNextPage {
-				break
+type repoResult struct {
+	repo      data.RepoInfo
+	policies  []data.BranchProtectionRule
+	skipped   bool
+	operation string
+	err       error
+}
+
+// fetchPages sends pages of repositories to list until every page has been
+// sent, a page fails, or done is closed.
+func (run *listRun) fetchPages(repos []string, reposCursor *string, done <-chan struct{}) <-chan repoPage {
+	pages := make(chan repoPage)
+
+	go func() {
+		defer close(pages)
+		send := func(page repoPage) bool {
+			select {
+			case pages <- page:
+				return true
+			case <-done:
+				return false
 			}
 		}
-	}
 
-	for _, singleRepo := range allRepos {
-		zap.S().Debugf("Gathering Branch Protection Policies for repo %s", singleRepo.Name)
-		var bpCursor *string
-		var allBPPolicies []data.BranchProtectionRule
+		if len(repos) > 0 {
+			zap.S().Infof("Processing repos: %s", repos)
+			var items []repoItem
+			for _, repo := range repos {
+				items = append(items, repoItem{repo: data.RepoInfo{Name: repo}, lookup: true, fetch: true})
+			}
+			send(repoPage{items: items})
+			return
+		}
+
 		for {
-			branchProtectionList, err := g.GetBranchProtections(owner, singleRepo.Name, bpCursor)
+			var page repoPage
+			var hasNextPage bool
+			if run.cmdFlags.team != "" {
+				zap.S().Debugf("Processing list of repositories for team %s in %s", run.cmdFlags.team, run.owner)
+				teamQuery, err := run.g.GetTeamRepos(run.owner, run.cmdFlags.team, reposCursor)
+				if err != nil {
+					send(repoPage{err: err})
+					return
+				}
 
-			if err != nil {
-				return err
-			}
+				team := teamQuery.Organization.Team
+				for _, edge := range team.Repositories.Edges {
+					if !utils.PermissionAtLeast(edge.Permission, run.cmdFlags.teamPermission) || !run.match(edge.Node) {
+						continue
+					}
+					page.items = append(page.items, repoItem{repo: edge.Node, fetch: true})
+				}
+				page.endCursor = &team.Repositories.PageInfo.EndCursor
+				hasNextPage = team.Repositories.PageInfo.HasNextPage
+			} else if run.cmdFlags.batch > 0 {
+				zap.S().Debugf("Processing list of repositories and branch protection rules for %s", run.owner)
+				reposQuery, err := run.g.GetReposListWithRules(run.owner, run.cmdFlags.batch, reposCursor)
+				if err != nil {
+					send(repoPage{err: err})
+					return
+				}
 
-			allBPPolicies = append(allBPPolicies, branchProtectionList.Repository.BranchProtectionRules.Nodes...)
-			bpCursor = &branchProtectionList.Repository.BranchProtectionRules.PageInfo.EndCursor
-			if !branchProtectionList.Repository.BranchProtectionRules.PageInfo.HasNextPage {
-				break
-			}
-		}
-		for _, policy := range allBPPolicies {
-			err = csvWriter.Write([]string{
-				singleRepo.Name,
-				strconv.Itoa(singleRepo.DatabaseId),
-				policy.Pattern,
-				policy.ID,
-				strconv.FormatBool(policy.AllowsDeletions),
-				strconv.FormatBool(policy.AllowsForcePushes),
-				strconv.FormatBool(policy.BlocksCreations),
-				strconv.FormatBool(policy.DismissesStaleReviews),
-				strconv.FormatBool(policy.IsAdminEnforced),
-				strconv.FormatBool(policy.LockAllowsFetchAndMerge),
-				strconv.FormatBool(policy.LockBranch),
-				strconv.FormatBool(policy.RequireLastPushApproval),
-				strconv.Itoa(policy.RequiredApprovingReviewCount),
-				strconv.FormatBool(policy.RequiresApprovingReviews),
-				strconv.FormatBool(policy.RequiresCodeOwnerReviews),
-				strconv.FormatBool(policy.RequiresCommitSignatures),
-				strconv.FormatBool(policy.RequiresConversationResolution),
-				strconv.FormatBool(policy.RequiresDeployments),
-				strconv.FormatBool(policy.RequiresLinearHistory),
-				strconv.FormatBool(policy.RequiresStatusChecks),
-				strconv.FormatBool(policy.RequiresStrictStatusChecks),
-				strconv.FormatBool(policy.RestrictsPushes),
-				strconv.FormatBool(policy.RestrictsReviewDismissals),
-			})
+				for _, repo := range reposQuery.RepositoryOwner.Repositories.Nodes {
+					if !run.match(repo.RepoInfo) {
+						continue
+					}
+					// Only repositories with more rules than the batch size need their own queries
+					page.items = append(page.items, repoItem{
+						repo:     repo.RepoInfo,
+						policies: repo.BranchProtectionRules.Nodes,
+						fetch:    repo.BranchProtectionRules.PageInfo.HasNextPage,
+						cursor:   &repo.BranchProtectionRules.PageInfo.EndCursor,
+					})
+				}
+				page.endCursor = &reposQuery.RepositoryOwner.Repositories.PageInfo.EndCursor
+				hasNextPage = reposQuery.RepositoryOwner.Repositories.PageInfo.HasNextPage
+			} else {
+				zap.S().Debugf("Processing list of repositories for %s", run.owner)
+				reposQuery, err := run.g.GetReposList(run.owner, reposCursor)
+				if err != nil {
+					send(repoPage{err: err})
+					return
+				}
 
-			if err != nil {
-				zap.S().Error("Error raised in writing output", zap.Error(err))
+				for _, repo := range reposQuery.RepositoryOwner.Repositories.Nodes {
+					if !run.match(repo) {
+						continue
+					}
+					page.items = append(page.items, repoItem{repo: repo, fetch: true})
+				}
+				page.endCursor = &reposQuery.RepositoryOwner.Repositories.PageInfo.EndCursor
+				hasNextPage = reposQuery.RepositoryOwner.Repositories.PageInfo.HasNextPage
+			}
+
+			if !send(page) || !hasNextPage {
+				return
 			}
+			reposCursor = page.endCursor
 		}
+	}()
 
+	return pages
+}
+
+// match reports whether the repository is selected by the repository filters,
+// before any of its rules are gathered.
+func (run *listRun) match(repo data.RepoInfo) bool {
+	if !run.filter.Match(repo) || !run.properties.Match(repo.Name, run.propertyFilters) {
+		zap.S().Debugf("Skipping %s/%s, excluded by repository filters", run.owner, repo.Name)
+		return false
 	}
-	fmt.Printf("Successfully listed repository level branch protection policies for %s", owner)
-	csvWriter.Flush()
+	return true
+}
+
+// writePage gathers the rules of each repository in the page using up to
+// --concurrency workers, and writes them to the report in page order as soon
+// as each repository and those before it are ready. The report is flushed and
+// checkpointed after every repository.
+func (run *listRun) writePage(page []repoItem) error {
+	var items []repoItem
+	for _, item := range page {
+		if run.checkpoint.IsCompleted(item.repo.Name) {
+			zap.S().Debugf("Skipping %s/%s, already listed", run.owner, item.repo.Name)
+			continue
+		}
+		items = append(items, item)
+	}
+
+	results := make([]chan repoResult, len(items))
+	for i := range results {
+		results[i] = make(chan repoResult, 1)
+	}
+
+	jobs := make(chan int)
+	var failed atomic.Bool
+	for w := 0; w < run.cmdFlags.concurrency; w++ {
+		go func() {
+			for i := range jobs {
+				// Drain remaining jobs without calling the API once a repository
+				// has failed. Drained repositories are skipped, so none of them
+				// is written or checkpointed before the failure is returned
+				if failed.Load() {
+					results[i] <- repoResult{repo: items[i].repo, skipped: true}
+					continue
+				}
+				result := run.gatherRepo(items[i])
+				if result.err != nil && !run.cmdFlags.continueOnError {
+					failed.Store(true)
+				}
+				results[i] <- result
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := range items {
+			jobs <- i
+		}
+	}()
+
+	for i := range items {
+		result := <-results[i]
+		if result.err != nil {
+			if !run.cmdFlags.continueOnError {
+				return result.err
+			}
+			run.repoErrors = append(run.repoErrors, utils.NewRepoError(run.repoName(result.repo.Name), result.operation, result.err))
+			continue
+		}
+		if result.skipped {
+			continue
+		}
 
+		if err := run.writeRepo(result.repo, result.policies); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+func (run *listRun) gatherRepo(item repoItem) repoResult {
+	result := repoResult{repo: item.repo, policies: item.policies}
+	if item.lookup {
+		zap.S().Debugf("Processing %s/%s", run.owner, item.repo.Name)
+		repoQuery, err := run.g.GetRepo(run.owner, item.repo.Name)
+		if err != nil {
+			result.operation = "getRepo"
+			result.err = err
+			return result
+		}
+		result.repo = repoQuery.Repository
+		if !run.match(result.repo) {
+			result.skipped = true
+			return result
+		}
+	}
+	if item.fetch {
+		remaining, err := getBranchProtections(run.owner, item.repo.Name, item.cursor, run.g)
+		if err != nil {
+			result.operation = "getBranchProtectionPolicies"
+			result.err = err
+			return result
+		}
+		result.policies = append(result.policies, remaining...)
+	}
+	return result
+}
+
+// writeRepo writes the rules of a repository to the report, then flushes and
+// checkpoints it.
+func (run *listRun) writeRepo(singleRepo data.RepoInfo, policies []data.BranchProtectionRule) error {
+	for _, policy := range policies {
+		// The fingerprint identifies the live settings, so it is taken before
+		// any fixes are applied to the row
+		fingerprint := utils.RuleFingerprint(policy)
+		if run.cmdFlags.lint {
+			var findings []utils.LintFinding
+			if run.cmdFlags.fix {
+				findings = utils.FixBranchProtectionRule(&policy, true)
+			} else {
+				findings = utils.LintBranchProtectionRule(policy, true)
+			}
+			for _, finding := range findings {
+				fmt.Fprintf(os.Stderr, "%s %s: %s\n", singleRepo.Name, policy.Pattern, finding)
+			}
+			run.lintCount += len(findings)
+		}
+
+		ruleRecord := utils.BranchProtectionRuleRecord(singleRepo, policy)
+		ruleRecord[utils.HeaderIndex(utils.BranchRulesHeader)["Fingerprint"]] = fingerprint
+		record := utils.ReportRecord(singleRepo, ruleRecord, run.cmdFlags.columns)
+		if run.owningTeams != nil {
+			record = append(record, strings.Join(run.owningTeams[singleRepo.Name], ";"))
+		}
+		record = append(record, run.properties.Record(singleRepo.Name, run.propertyNames)...)
+		if run.withOrganization {
+			record = append([]string{run.owner}, record...)
+		}
+		err := run.report.Write(record)
+
+		if err != nil {
+			zap.S().Error("Error raised in writing output", zap.Error(err))
+		}
+	}
+
+	run.report.Flush()
+	if err := run.report.Error(); err != nil {
+		return err
+	}
+	return run.checkpoint.Complete(singleRepo.Name)
+}
+
+// keepPartialReport keeps the rows written to a report that could not be
+// completed, telling the user where they are.
+func keepPartialReport(reportFile *utils.ReportFile) {
+	partial, err := reportFile.KeepPartial()
+	if err != nil {
+		zap.S().Errorf("Unable to keep the partial report: %v", err)
+		return
+	}
+	if partial != "" {
+		fmt.Fprintf(os.Stderr, "The run did not complete, rows listed so far were written to %s\n", partial)
+	}
+}
+
+// repoName returns the name of a repository as it is reported, including its
+// owner when several owners are listed.
+func (run *listRun) repoName(repo string) string {
+	if run.withOrganization {
+		return run.owner + "/" + repo
+	}
+	return repo
+}
+
+// tableColumns are the columns of a table report unless others are asked
+// for: the repository and pattern of each rule, with its most commonly
+// checked settings.
+var tableColumns = []string{
+	"RepositoryName",
+	"BranchProtectionRulePattern",
+	"RequiresApprovingReviews",
+	"RequiredApprovingReviewCount",
+	"RequiresCodeOwnerReviews",
+	"RequiresStatusChecks",
+	"IsAdminEnforced",
+	"AllowsForcePushes",
+	"AllowsDeletions",
+}
+
+// propertyColumns returns the report column of each custom property.
+func propertyColumns(names []string) []string {
+	columns := make([]string, len(names))
+	for i, name := range names {
+		columns[i] = utils.PropertyColumnPrefix + name
+	}
+	return columns
+}
+
+// getBranchProtections gathers the branch protection rules of a repository,
+// starting after bpCursor when it is set.
+func getBranchProtections(owner string, repo string, bpCursor *string, g *utils.APIGetter) ([]data.BranchProtectionRule, error) {
+	zap.S().Debugf("Gathering Branch Protection Policies for repo %s", repo)
+	var allBPPolicies []data.BranchProtectionRule
+	for {
+		branchProtectionList, err := g.GetBranchProtections(owner, repo, bpCursor)
+
+		if err != nil {
+			return nil, err
+		}
+
+		allBPPolicies = append(allBPPolicies, branchProtectionList.Repository.BranchProtectionRules.Nodes...)
+		bpCursor = &branchProtectionList.Repository.BranchProtectionRules.PageInfo.EndCursor
+		if !branchProtectionList.Repository.BranchProtectionRules.PageInfo.HasNextPage {
+			break
+		}
+	}
+	return allBPPolicies, nil
+}
@@ -0,0 +1,141 @@
+package rollback
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cli/go-gh/v2/pkg/api"
+	"github.com/cli/go-gh/v2/pkg/auth"
+	"github.com/katiem0/gh-branch-rules/internal/log"
+	"github.com/katiem0/gh-branch-rules/internal/utils"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+type cmdFlags struct {
+	token       string
+	hostname    string
+	maxRetries  int
+	resultsFile string
+	debug       bool
+}
+
+func NewCmdRollback() *cobra.Command {
+	cmdFlags := cmdFlags{}
+	var authToken string
+
+	rollbackCmd := &cobra.Command{
+		Use:   "rollback [flags] <snapshot>",
+		Short: "Restore branch protection policies from a snapshot.",
+		Long:  "Restore branch protection policies to the settings saved in a snapshot taken by update.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(rollbackCmd *cobra.Command, args []string) error {
+			var err error
+			var restClient *api.RESTClient
+			var gqlClient *api.GraphQLClient
+
+			// Reinitialize logging, including debug logging if it was enabled
+			logger, _ := log.NewLogger(cmdFlags.debug)
+			defer logger.Sync() // nolint:errcheck
+			zap.ReplaceGlobals(logger)
+
+			if cmdFlags.token != "" {
+				authToken = cmdFlags.token
+			} else {
+				t, _ := auth.TokenForHost(cmdFlags.hostname)
+				authToken = t
+			}
+
+			rateLimiter := utils.NewRateLimiter()
+
+			restClient, err = api.NewRESTClient(api.ClientOptions{
+				Headers: map[string]string{
+					"Accept": "application/vnd.github+json",
+				},
+				Host:      cmdFlags.hostname,
+				AuthToken: authToken,
+				Transport: rateLimiter.RoundTripper(http.DefaultTransport),
+			})
+
+			if err != nil {
+				zap.S().Errorf("Error arose retrieving rest client")
+				return err
+			}
+
+			gqlClient, err = api.NewGraphQLClient(api.ClientOptions{
+				Headers: map[string]string{
+					"Accept": "application/vnd.github.hawkgirl-preview+json",
+				},
+				Host:      cmdFlags.hostname,
+				AuthToken: authToken,
+				Transport: rateLimiter.RoundTripper(http.DefaultTransport),
+			})
+
+			if err != nil {
+				zap.S().Errorf("Error arose retrieving graphql client")
+				return err
+			}
+			snapshotFile := args[0]
+
+			if cmdFlags.maxRetries < 0 {
+				return fmt.Errorf("--max-retries must not be negative, got %d", cmdFlags.maxRetries)
+			}
+
+			rollbackCmd.SilenceUsage = true
+			return runCmdRollback(snapshotFile, &cmdFlags, utils.NewAPIGetter(gqlClient, restClient, rateLimiter, cmdFlags.maxRetries))
+		},
+	}
+	resultsFileDefault := fmt.Sprintf("BranchRulesRollback-%s.csv", time.Now().Format("20060102150405"))
+
+	// Configure flags for command
+	rollbackCmd.PersistentFlags().StringVarP(&cmdFlags.token, "token", "t", "", `GitHub personal access token for organization to write to (default "gh auth token")`)
+	rollbackCmd.PersistentFlags().StringVarP(&cmdFlags.hostname, "hostname", "", "github.com", "GitHub Enterprise Server hostname")
+	rollbackCmd.PersistentFlags().IntVar(&cmdFlags.maxRetries, "max-retries", 3, "Maximum number of times to retry a request after a transient error")
+	rollbackCmd.Flags().StringVarP(&cmdFlags.resultsFile, "results-file", "r", resultsFileDefault, "Name of file to write the outcome of each row to")
+	rollbackCmd.PersistentFlags().BoolVarP(&cmdFlags.debug, "debug", "d", false, "To debug logging")
+
+	return rollbackCmd
+}
+
+func runCmdRollback(snapshotFile string, cmdFlags *cmdFlags, g *utils.APIGetter) error {
+	zap.S().Infof("Reading in snapshot %s and restoring branch protection policies", snapshotFile)
+	entries, err := utils.ReadSnapshot(snapshotFile)
+	if err != nil {
+		zap.S().Errorf("Error arose reading snapshot %s", snapshotFile)
+		return err
+	}
+
+	var results []utils.UpdateResult
+	var failed int
+	for i, entry := range entries {
+		result := utils.UpdateResult{
+			Row:            i + 2,
+			RepositoryName: entry.Repository.Name,
+			Pattern:        entry.Rule.Pattern,
+			ID:             entry.Rule.ID,
+			Status:         utils.UpdateApplied,
+		}
+
+		zap.S().Debugf("Restoring branch policy %s with ID %s", entry.Rule.Pattern, entry.Rule.ID)
+		err = g.UpdateBranchProtectionPolicies(entry.Rule)
+		if err != nil {
+			zap.S().Errorf("Error arose restoring branch policy %s in %s: %v", entry.Rule.Pattern, entry.Repository.Name, err)
+			result.Status = utils.UpdateFailed
+			result.Reason = err.Error()
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if err := utils.WriteUpdateResults(cmdFlags.resultsFile, results); err != nil {
+		zap.S().Errorf("Error arose writing rollback results to %s", cmdFlags.resultsFile)
+		return err
+	}
+
+	fmt.Printf("Restored %d, failed %d of %d branch protection policies from %s, results are recorded in %s\n", len(results)-failed, failed, len(results), snapshotFile, cmdFlags.resultsFile)
+	if failed > 0 {
+		return fmt.Errorf("%d branch protection policies failed to restore", failed)
+	}
+	return nil
+}
@@ -4,7 +4,9 @@ import (
 	"github.com/spf13/cobra"
 
 	listCmd "github.com/katiem0/gh-branch-rules/cmd/list"
+	rollbackCmd "github.com/katiem0/gh-branch-rules/cmd/rollback"
 	updateCmd "github.com/katiem0/gh-branch-rules/cmd/update"
+	validateCmd "github.com/katiem0/gh-branch-rules/cmd/validate"
 )
 
 func NewCmdRoot() *cobra.Command {
@@ -12,11 +14,13 @@ func NewCmdRoot() *cobra.Command {
 	cmdRoot := &cobra.Command{
 		Use:   "branch-rules <command> [flags]",
 		Short: "List and update branch protection rules.",
-		Long:  "List and update branch protection rules for repositories in an organization.",
+		Long:  "List and update branch protection rules for repositories in an organization or user account.",
 	}
 
 	cmdRoot.AddCommand(listCmd.NewCmdList())
 	cmdRoot.AddCommand(updateCmd.NewCmdUpdate())
+	cmdRoot.AddCommand(validateCmd.NewCmdValidate())
+	cmdRoot.AddCommand(rollbackCmd.NewCmdRollback())
 	cmdRoot.CompletionOptions.DisableDefaultCmd = true
 	cmdRoot.SetHelpCommand(&cobra.Command{
 		Use:    "no-help",
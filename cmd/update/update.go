@@ -1,12 +1,16 @@
 package update
 
 import (
-	"encoding/csv"
+	"bufio"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/cli/go-gh/v2/pkg/api"
 	"github.com/cli/go-gh/v2/pkg/auth"
+	"github.com/cli/go-gh/v2/pkg/term"
 	"github.com/katiem0/gh-branch-rules/internal/data"
 	"github.com/katiem0/gh-branch-rules/internal/log"
 	"github.com/katiem0/gh-branch-rules/internal/utils"
@@ -15,10 +19,17 @@ import (
 )
 
 type cmdFlags struct {
-	token    string
-	hostname string
-	fileName string
-	debug    bool
+	token          string
+	hostname       string
+	maxRetries     int
+	fileName       string
+	resultsFile    string
+	snapshotFile   string
+	properties     []string
+	team           string
+	teamPermission string
+	reposFile      string
+	debug          bool
 }
 
 func NewCmdUpdate() *cobra.Command {
@@ -26,21 +37,19 @@ func NewCmdUpdate() *cobra.Command {
 	var authToken string
 
 	updateCmd := &cobra.Command{
-		Use:   "update [flags] <organization>",
+		Use:   "update [flags] [<owner>]",
 		Short: "update branch protection policies",
-		Long:  "Update branch protection policies for repositories from a file.",
-		Args:  cobra.ExactArgs(1),
+		Long:  "Update branch protection policies for repositories from a file, in owner or in the organization named by each row's Organization column.",
+		Args:  cobra.RangeArgs(0, 1),
 		RunE: func(createCmd *cobra.Command, args []string) error {
 			var err error
 			var restClient *api.RESTClient
 			var gqlClient *api.GraphQLClient
 
-			// Reinitialize logging if debugging was enabled
-			if cmdFlags.debug {
-				logger, _ := log.NewLogger(cmdFlags.debug)
-				defer logger.Sync() // nolint:errcheck
-				zap.ReplaceGlobals(logger)
-			}
+			// Reinitialize logging, including debug logging if it was enabled
+			logger, _ := log.NewLogger(cmdFlags.debug)
+			defer logger.Sync() // nolint:errcheck
+			zap.ReplaceGlobals(logger)
 
 			if cmdFlags.token != "" {
 				authToken = cmdFlags.token
@@ -49,12 +58,15 @@ func NewCmdUpdate() *cobra.Command {
 				authToken = t
 			}
 
+			rateLimiter := utils.NewRateLimiter()
+
 			restClient, err = api.NewRESTClient(api.ClientOptions{
 				Headers: map[string]string{
 					"Accept": "application/vnd.github+json",
 				},
 				Host:      cmdFlags.hostname,
 				AuthToken: authToken,
+				Transport: rateLimiter.RoundTripper(http.DefaultTransport),
 			})
 
 			if err != nil {
@@ -68,21 +80,50 @@ func NewCmdUpdate() *cobra.Command {
 				},
 				Host:      cmdFlags.hostname,
 				AuthToken: authToken,
+				Transport: rateLimiter.RoundTripper(http.DefaultTransport),
 			})
 
 			if err != nil {
 				zap.S().Errorf("Error arose retrieving graphql client")
 				return err
 			}
-			owner := args[0]
+			var owner string
+			if len(args) > 0 {
+				owner = args[0]
+			}
+
+			if cmdFlags.maxRetries < 0 {
+				return fmt.Errorf("--max-retries must not be negative, got %d", cmdFlags.maxRetries)
+			}
 
-			return runCmdUpdate(owner, &cmdFlags, utils.NewAPIGetter(gqlClient, restClient))
+			if cmdFlags.teamPermission != "" {
+				if cmdFlags.team == "" {
+					return fmt.Errorf("--team-permission requires --team")
+				}
+				cmdFlags.teamPermission, err = utils.ParseTeamPermission(cmdFlags.teamPermission)
+				if err != nil {
+					return err
+				}
+			}
+
+			createCmd.SilenceUsage = true
+			return runCmdUpdate(owner, &cmdFlags, utils.NewAPIGetter(gqlClient, restClient, rateLimiter, cmdFlags.maxRetries))
 		},
 	}
+	resultsFileDefault := fmt.Sprintf("BranchRulesUpdate-%s.csv", time.Now().Format("20060102150405"))
+	snapshotFileDefault := fmt.Sprintf("BranchRulesSnapshot-%s.csv", time.Now().Format("20060102150405"))
+
 	// Configure flags for command
 	updateCmd.PersistentFlags().StringVarP(&cmdFlags.token, "token", "t", "", `GitHub personal access token for organization to write to (default "gh auth token")`)
 	updateCmd.PersistentFlags().StringVarP(&cmdFlags.hostname, "hostname", "", "github.com", "GitHub Enterprise Server hostname")
+	updateCmd.PersistentFlags().IntVar(&cmdFlags.maxRetries, "max-retries", 3, "Maximum number of times to retry a request after a transient error")
 	updateCmd.Flags().StringVarP(&cmdFlags.fileName, "from-file", "f", "", "Path and Name of CSV file to create branch rules from")
+	updateCmd.Flags().StringVarP(&cmdFlags.resultsFile, "results-file", "r", resultsFileDefault, "Name of file to write the outcome of each row to")
+	updateCmd.Flags().StringVarP(&cmdFlags.snapshotFile, "snapshot-file", "s", snapshotFileDefault, "Name of file to save the current settings of each rule to before updating")
+	updateCmd.Flags().StringArrayVar(&cmdFlags.properties, "property", nil, "Only update repositories with this custom property value, as key=value, may be repeated to require several")
+	updateCmd.Flags().StringVar(&cmdFlags.reposFile, "repos-file", "", "Name of file to read repositories to update from, one repo or owner/repo per line (- for stdin)")
+	updateCmd.Flags().StringVar(&cmdFlags.team, "team", "", "Only update repositories the team with this slug has access to")
+	updateCmd.Flags().StringVar(&cmdFlags.teamPermission, "team-permission", "", "Only update repositories on which --team has at least this permission: read, triage, write, maintain or admin")
 	updateCmd.PersistentFlags().BoolVarP(&cmdFlags.debug, "debug", "d", false, "To debug logging")
 	updateCmd.MarkFlagRequired("from-file")
 
@@ -90,39 +131,281 @@ func NewCmdUpdate() *cobra.Command {
 }
 
 func runCmdUpdate(owner string, cmdFlags *cmdFlags, g *utils.APIGetter) error {
-	var policyData [][]string
-	var importBranchPolicyList []data.BranchProtectionRule
 	zap.S().Infof("Reading in file %s and updating branch protection policies", cmdFlags.fileName)
-	if len(cmdFlags.fileName) > 0 {
-		f, err := os.Open(cmdFlags.fileName)
-		zap.S().Debugf("Opening up file %s", cmdFlags.fileName)
-		if err != nil {
-			zap.S().Errorf("Error arose opening branch protection policies csv file")
-		}
-		// remember to close the file at the end of the program
-		defer f.Close()
-		// read csv values using csv.Reader
-		csvReader := csv.NewReader(f)
-		policyData, err = csvReader.ReadAll()
-		zap.S().Debugf("Reading in all lines from csv file")
+	zap.S().Debugf("Opening up file %s", cmdFlags.fileName)
+	policyData, err := utils.ReadBranchRulesFile(cmdFlags.fileName)
+	zap.S().Debugf("Reading in all lines from csv file")
+	if err != nil {
+		zap.S().Errorf("Error arose reading assignments from csv file")
+		return err
+	}
+	validationErrors := utils.ValidateBranchProtectionPolicyData(policyData)
+	for _, validationError := range validationErrors {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", cmdFlags.fileName, validationError)
+	}
+	if len(validationErrors) > 0 {
+		return fmt.Errorf("found %d error(s) in %s, no branch protection policies were updated", len(validationErrors), cmdFlags.fileName)
+	}
+	importBranchPolicyList := utils.CreateBranchProtectionPolicyData(policyData)
+	col := utils.HeaderIndex(policyData[0])
+
+	// Rules are fetched at most once, before any of them are modified.
+	// Settings left out of the file are taken from the live rule
+	liveRules := make([]*data.BranchProtectionRuleNodeQuery, len(importBranchPolicyList))
+	snapshotErrs := make([]error, len(importBranchPolicyList))
+	capture := func(i int) error {
+		if liveRules[i] == nil && snapshotErrs[i] == nil {
+			zap.S().Debugf("Capturing current state of branch policy with ID %s", importBranchPolicyList[i].ID)
+			liveRules[i], snapshotErrs[i] = g.GetBranchProtectionRule(importBranchPolicyList[i].ID)
+		}
+		return snapshotErrs[i]
+	}
+
+	// Each row is in the organization named by its Organization column, or
+	// in owner when the column is absent or empty
+	rowOwners := make([]string, len(importBranchPolicyList))
+	var owners []string
+	seenOwners := make(map[string]bool)
+	for i := range importBranchPolicyList {
+		rowOwners[i] = owner
+		if orgCol, ok := col["Organization"]; ok && policyData[i+1][orgCol] != "" {
+			rowOwners[i] = policyData[i+1][orgCol]
+		}
+		if rowOwners[i] == "" {
+			return fmt.Errorf("%s row %d has no Organization, and no owner was given, no branch protection policies were updated", cmdFlags.fileName, i+2)
+		}
+		if !seenOwners[strings.ToLower(rowOwners[i])] {
+			seenOwners[strings.ToLower(rowOwners[i])] = true
+			owners = append(owners, rowOwners[i])
+		}
+	}
+	target := strings.Join(owners, ",")
+
+	// Rows are scoped by the repository their rule is in, rather than the
+	// one named in the file. A row naming another repository is stale or
+	// mistyped, and is left unchanged
+	repoNames := make([]string, len(importBranchPolicyList))
+	mismatches := make([]string, len(importBranchPolicyList))
+	for i := range importBranchPolicyList {
+		repoCol, hasRepo := col["RepositoryName"]
+		if hasRepo {
+			repoNames[i] = policyData[i+1][repoCol]
+		}
+		if err := capture(i); err != nil {
+			continue
+		}
+		liveName := liveRules[i].Node.BranchProtectionRule.Repository.Name
+		if hasRepo && !strings.EqualFold(repoNames[i], liveName) {
+			mismatches[i] = fmt.Sprintf("rule %s is in repository %s, not %s", importBranchPolicyList[i].ID, liveName, repoNames[i])
+		}
+		repoNames[i] = liveName
+	}
+
+	// Rows are only updated for repositories with the selected custom
+	// property values, team access and repositories file, and excluded holds the reason for
+	// skipping any other row
+	excluded := make([]string, len(importBranchPolicyList))
+	propertyFilters, err := utils.ParsePropertyFilters(cmdFlags.properties)
+	if err != nil {
+		return err
+	}
+	if len(propertyFilters) > 0 || cmdFlags.team != "" {
+		for _, owner := range owners {
+			ownerType, err := g.GetOwnerType(owner)
+			if err != nil {
+				zap.S().Errorf("Error arose looking up %s", owner)
+				return err
+			}
+			if ownerType != "Organization" {
+				return fmt.Errorf("%s is a user, --property and --team are only available for organizations", owner)
+			}
+		}
+	}
+	if len(propertyFilters) > 0 {
+		for _, owner := range owners {
+			allValues, err := g.GetRepoProperties(owner)
+			if err != nil {
+				zap.S().Errorf("Error arose retrieving custom property values for %s", owner)
+				return err
+			}
+			properties := utils.NewRepoProperties(allValues)
+			for i := range importBranchPolicyList {
+				if strings.EqualFold(rowOwners[i], owner) && snapshotErrs[i] == nil && !properties.Match(repoNames[i], propertyFilters) {
+					excluded[i] = "excluded by --property"
+				}
+			}
+		}
+	}
+	if cmdFlags.reposFile != "" {
+		fileRepos, err := utils.ReadReposFile(cmdFlags.reposFile, owner)
 		if err != nil {
-			zap.S().Errorf("Error arose reading assignments from csv file")
+			zap.S().Errorf("Error arose reading repositories from %s", cmdFlags.reposFile)
+			return err
+		}
+		inFile := make(map[string]bool, len(fileRepos))
+		for _, repo := range fileRepos {
+			inFile[strings.ToLower(repo)] = true
 		}
-		importBranchPolicyList = utils.CreateBranchProtectionPolicyData(policyData)
-	} else {
-		zap.S().Errorf("Error arose identifying users to add")
+		for i := range importBranchPolicyList {
+			fullName := strings.ToLower(rowOwners[i] + "/" + repoNames[i])
+			if excluded[i] == "" && snapshotErrs[i] == nil && !inFile[fullName] {
+				excluded[i] = "excluded by --repos-file"
+			}
+		}
+	}
+	if cmdFlags.team != "" {
+		for _, owner := range owners {
+			teamRepos, err := g.GetAllTeamRepos(owner, cmdFlags.team, cmdFlags.teamPermission)
+			if err != nil {
+				zap.S().Errorf("Error arose retrieving repositories for team %s in %s", cmdFlags.team, owner)
+				return err
+			}
+			inTeam := make(map[string]bool, len(teamRepos))
+			for _, repo := range teamRepos {
+				inTeam[strings.ToLower(repo.Name)] = true
+			}
+			for i := range importBranchPolicyList {
+				if strings.EqualFold(rowOwners[i], owner) && excluded[i] == "" && snapshotErrs[i] == nil && !inTeam[strings.ToLower(repoNames[i])] {
+					excluded[i] = "excluded by --team"
+				}
+			}
+		}
+	}
+
+	// Capture the current state of every rule before any of them are modified
+	var snapshot []utils.SnapshotEntry
+	currentRules := make([]data.BranchProtectionRule, len(importBranchPolicyList))
+	conflicts := make([]bool, len(importBranchPolicyList))
+	for i := range importBranchPolicyList {
+		if excluded[i] != "" || mismatches[i] != "" {
+			continue
+		}
+		if err := capture(i); err != nil {
+			continue
+		}
+		current := liveRules[i]
+		currentRules[i] = current.Node.BranchProtectionRule.BranchProtectionRule
+		importBranchPolicyList[i] = currentRules[i]
+		utils.ApplyBranchProtectionRecord(&importBranchPolicyList[i], col, policyData[i+1])
+		importBranchPolicy := importBranchPolicyList[i]
+
+		// Rules changed by someone else since they were listed are only
+		// overwritten when confirmed
+		if fingerprintCol, ok := col["Fingerprint"]; ok {
+			expected := policyData[i+1][fingerprintCol]
+			if expected != "" && expected != utils.RuleFingerprint(currentRules[i]) && !confirmOverwrite(importBranchPolicy.Pattern, repoNames[i]) {
+				conflicts[i] = true
+				continue
+			}
+		}
+		snapshot = append(snapshot, utils.SnapshotEntry{
+			Repository: current.Node.BranchProtectionRule.Repository,
+			Rule:       current.Node.BranchProtectionRule.BranchProtectionRule,
+			Action:     utils.SnapshotRestore,
+		})
+	}
+	if err := utils.WriteSnapshot(cmdFlags.snapshotFile, snapshot); err != nil {
+		zap.S().Errorf("Error arose writing snapshot to %s, no branch protection policies were updated", cmdFlags.snapshotFile)
+		return err
 	}
-	zap.S().Debugf("Determining permissions to create")
 
-	for _, importBranchPolicy := range importBranchPolicyList {
+	var results []utils.UpdateResult
+	var unchanged, skipped, failed int
+	for i, importBranchPolicy := range importBranchPolicyList {
 		zap.S().Debugf("Updating branch policy %s with ID %s", importBranchPolicy.Pattern, importBranchPolicy.ID)
+		result := utils.UpdateResult{
+			Row:            i + 2,
+			RepositoryName: repoNames[i],
+			Pattern:        importBranchPolicy.Pattern,
+			ID:             importBranchPolicy.ID,
+			Status:         utils.UpdateApplied,
+		}
+		if _, ok := col["Organization"]; ok {
+			result.RepositoryName = rowOwners[i] + "/" + result.RepositoryName
+		}
+
+		if mismatches[i] != "" {
+			zap.S().Errorf("Branch policy %s in %s does not match its file row, %s", importBranchPolicy.Pattern, result.RepositoryName, mismatches[i])
+			result.Status = utils.UpdateFailed
+			result.Reason = mismatches[i]
+			failed++
+			results = append(results, result)
+			continue
+		}
+
+		if excluded[i] != "" {
+			zap.S().Debugf("Skipping branch policy %s in %s, %s", importBranchPolicy.Pattern, result.RepositoryName, excluded[i])
+			result.Status = utils.UpdateSkipped
+			result.Reason = excluded[i]
+			skipped++
+			results = append(results, result)
+			continue
+		}
+
+		// Rules that could not be captured are left unchanged so that they can
+		// always be rolled back
+		if snapshotErrs[i] != nil {
+			zap.S().Errorf("Error arose capturing branch policy %s in %s: %v", importBranchPolicy.Pattern, result.RepositoryName, snapshotErrs[i])
+			result.Status = utils.UpdateFailed
+			result.Reason = fmt.Sprintf("unable to capture current state: %v", snapshotErrs[i])
+			failed++
+			results = append(results, result)
+			continue
+		}
+
+		if conflicts[i] {
+			zap.S().Errorf("Branch policy %s in %s was changed since it was listed, skipping", importBranchPolicy.Pattern, result.RepositoryName)
+			result.Status = utils.UpdateFailed
+			result.Reason = "rule was changed since it was listed, its fingerprint no longer matches"
+			failed++
+			results = append(results, result)
+			continue
+		}
+
+		changed := utils.ChangedFields(currentRules[i], importBranchPolicy)
+		if len(changed) == 0 {
+			zap.S().Debugf("Skipping branch policy %s in %s, settings are unchanged", importBranchPolicy.Pattern, result.RepositoryName)
+			result.Status = utils.UpdateUnchanged
+			unchanged++
+			results = append(results, result)
+			continue
+		}
 
 		err := g.UpdateBranchProtectionPolicies(importBranchPolicy)
 		if err != nil {
-			zap.S().Errorf("Error arose creating permission %s", importBranchPolicy.Pattern)
+			zap.S().Errorf("Error arose updating branch policy %s in %s: %v", importBranchPolicy.Pattern, result.RepositoryName, err)
+			result.Status = utils.UpdateFailed
+			result.Reason = err.Error()
+			failed++
+		} else {
+			result.Reason = "changed " + strings.Join(changed, ", ")
 		}
+		results = append(results, result)
 	}
 
-	fmt.Printf("Successfully updated branch protection policies from %s in org %s", cmdFlags.fileName, owner)
+	if err := utils.WriteUpdateResults(cmdFlags.resultsFile, results); err != nil {
+		zap.S().Errorf("Error arose writing update results to %s", cmdFlags.resultsFile)
+		return err
+	}
+
+	fmt.Printf("Applied %d, unchanged %d, skipped %d, failed %d of %d branch protection policies from %s in org %s, results are recorded in %s\n", len(results)-unchanged-skipped-failed, unchanged, skipped, failed, len(results), cmdFlags.fileName, target, cmdFlags.resultsFile)
+	fmt.Printf("Previous settings are saved in %s, run `gh branch-rules rollback %s` to restore them\n", cmdFlags.snapshotFile, cmdFlags.snapshotFile)
+	if failed > 0 {
+		return fmt.Errorf("%d branch protection policies failed to update", failed)
+	}
 	return nil
 }
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// confirmOverwrite asks whether to overwrite a rule that was changed since it
+// was listed. Rules are never overwritten when there is no terminal to ask on.
+func confirmOverwrite(pattern string, repo string) bool {
+	if !term.IsTerminal(os.Stdin) || !term.IsTerminal(os.Stderr) {
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "Branch policy %s in %s was changed since it was listed, overwrite it? [y/N] ", pattern, repo)
+	answer, _ := stdin.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,128 @@
+package validate
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+
+	"github.com/katiem0/gh-branch-rules/internal/log"
+	"github.com/katiem0/gh-branch-rules/internal/utils"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+type cmdFlags struct {
+	fileName string
+	fix      bool
+	debug    bool
+}
+
+func NewCmdValidate() *cobra.Command {
+	cmdFlags := cmdFlags{}
+
+	validateCmd := &cobra.Command{
+		Use:   "validate [flags]",
+		Short: "Validate a branch protection rules file.",
+		Long:  "Validate a branch protection rules file and report contradictory or ineffective settings without making any API calls.",
+		Args:  cobra.NoArgs,
+		RunE: func(validateCmd *cobra.Command, args []string) error {
+			// Reinitialize logging, including debug logging if it was enabled
+			logger, _ := log.NewLogger(cmdFlags.debug)
+			defer logger.Sync() // nolint:errcheck
+			zap.ReplaceGlobals(logger)
+
+			validateCmd.SilenceUsage = true
+			return runCmdValidate(&cmdFlags)
+		},
+	}
+
+	// Configure flags for command
+	validateCmd.Flags().StringVarP(&cmdFlags.fileName, "from-file", "f", "", "Path and Name of CSV file to validate")
+	validateCmd.Flags().BoolVar(&cmdFlags.fix, "fix", false, "Rewrite the file with contradictory or ineffective settings normalized")
+	validateCmd.PersistentFlags().BoolVarP(&cmdFlags.debug, "debug", "d", false, "To debug logging")
+	validateCmd.MarkFlagRequired("from-file")
+
+	return validateCmd
+}
+
+func runCmdValidate(cmdFlags *cmdFlags) error {
+	zap.S().Debugf("Reading in file %s", cmdFlags.fileName)
+	policyData, err := utils.ReadBranchRulesFile(cmdFlags.fileName)
+	if err != nil {
+		zap.S().Errorf("Error arose reading branch protection policies csv file")
+		return err
+	}
+
+	validationErrors := utils.ValidateBranchProtectionPolicyData(policyData)
+	for _, validationError := range validationErrors {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", cmdFlags.fileName, validationError)
+	}
+	if len(validationErrors) > 0 {
+		return fmt.Errorf("found %d error(s) in %s", len(validationErrors), cmdFlags.fileName)
+	}
+
+	// Settings can only be checked against each other when every one of them
+	// is in the file
+	if missing := utils.MissingSettingColumns(policyData[0]); len(missing) > 0 {
+		fmt.Fprintf(os.Stderr, "%s: skipping checks for contradictory settings, %d setting column(s) such as %s are not in the file\n", cmdFlags.fileName, len(missing), missing[0])
+		fmt.Printf("Successfully validated %d branch protection policies in %s\n", len(policyData)-1, cmdFlags.fileName)
+		return nil
+	}
+
+	var lintCount int
+	col := utils.HeaderIndex(policyData[0])
+	for i, policy := range utils.CreateBranchProtectionPolicyData(policyData) {
+		var findings []utils.LintFinding
+		if cmdFlags.fix {
+			findings = utils.FixBranchProtectionRule(&policy, false)
+			for name, value := range utils.BranchProtectionRuleValues(policy) {
+				policyData[i+1][col[name]] = value
+			}
+		} else {
+			findings = utils.LintBranchProtectionRule(policy, false)
+		}
+		for _, finding := range findings {
+			fmt.Fprintf(os.Stderr, "%s: row %d: %s\n", cmdFlags.fileName, i+2, finding)
+		}
+		lintCount += len(findings)
+	}
+
+	if cmdFlags.fix && lintCount > 0 {
+		zap.S().Debugf("Writing normalized settings to %s", cmdFlags.fileName)
+		if err := writeBranchRulesFile(cmdFlags.fileName, policyData); err != nil {
+			zap.S().Errorf("Error arose writing normalized branch protection policies")
+			return err
+		}
+		fmt.Printf("Normalized %d contradictory or ineffective setting(s) in %s\n", lintCount, cmdFlags.fileName)
+	} else if lintCount > 0 {
+		fmt.Printf("Found %d contradictory or ineffective setting(s) in %s, use --fix to normalize them\n", lintCount, cmdFlags.fileName)
+	}
+
+	fmt.Printf("Successfully validated %d branch protection policies in %s\n", len(policyData)-1, cmdFlags.fileName)
+	return nil
+}
+
+// writeBranchRulesFile replaces fileName with policyData through a temporary
+// file, so that the file is left as it was if writing fails. The file keeps
+// its permissions.
+func writeBranchRulesFile(fileName string, policyData [][]string) error {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return err
+	}
+	f, err := utils.OpenReportFile(fileName, false, false)
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(info.Mode().Perm()); err != nil {
+		f.Discard() // nolint:errcheck
+		return err
+	}
+
+	csvWriter := csv.NewWriter(f)
+	if err := csvWriter.WriteAll(policyData); err != nil {
+		f.Discard() // nolint:errcheck
+		return err
+	}
+	return f.Commit()
+}
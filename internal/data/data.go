@@ -1,26 +1,171 @@
 package data
 
-import "github.com/shurcooL/graphql"
+import (
+	"time"
 
+	"github.com/shurcooL/graphql"
+)
+
+type RateLimit struct {
+	Cost      int
+	Remaining int
+	ResetAt   time.Time
+}
+
+// OwnerQuery looks up whether an owner is an Organization or a User.
+type OwnerQuery struct {
+	RateLimit       RateLimit `graphql:"rateLimit"`
+	RepositoryOwner struct {
+		Typename string `graphql:"__typename"`
+	} `graphql:"repositoryOwner(login: $owner)"`
+}
+
+type EnterpriseOrgsQuery struct {
+	RateLimit  RateLimit `graphql:"rateLimit"`
+	Enterprise struct {
+		Organizations struct {
+			Nodes []struct {
+				Login string
+			}
+			PageInfo struct {
+				EndCursor   string
+				HasNextPage bool
+			}
+		} `graphql:"organizations(first: 100, after: $endCursor)"`
+	} `graphql:"enterprise(slug: $slug)"`
+}
+
+// ReposQuery lists the repositories owned by an organization or user, without
+// those the owner only collaborates on.
 type ReposQuery struct {
-	Organization struct {
+	RateLimit       RateLimit `graphql:"rateLimit"`
+	RepositoryOwner struct {
 		Repositories struct {
 			Nodes    []RepoInfo
 			PageInfo struct {
 				EndCursor   string
 				HasNextPage bool
 			}
-		} `graphql:"repositories(first: 100, after: $endCursor)"`
+		} `graphql:"repositories(first: 100, after: $endCursor, ownerAffiliations: OWNER)"`
+	} `graphql:"repositoryOwner(login: $owner)"`
+}
+
+type ReposWithRulesQuery struct {
+	RateLimit       RateLimit `graphql:"rateLimit"`
+	RepositoryOwner struct {
+		Repositories struct {
+			Nodes    []RepoWithRules
+			PageInfo struct {
+				EndCursor   string
+				HasNextPage bool
+			}
+		} `graphql:"repositories(first: 100, after: $endCursor, ownerAffiliations: OWNER)"`
+	} `graphql:"repositoryOwner(login: $owner)"`
+}
+
+type TeamReposQuery struct {
+	RateLimit    RateLimit `graphql:"rateLimit"`
+	Organization struct {
+		Team struct {
+			Slug         string
+			Repositories struct {
+				Edges    []TeamRepoEdge
+				PageInfo struct {
+					EndCursor   string
+					HasNextPage bool
+				}
+			} `graphql:"repositories(first: 100, after: $endCursor)"`
+		} `graphql:"team(slug: $slug)"`
+	} `graphql:"organization(login: $owner)"`
+}
+
+type TeamsQuery struct {
+	RateLimit    RateLimit `graphql:"rateLimit"`
+	Organization struct {
+		Teams struct {
+			Nodes []struct {
+				Slug         string
+				Repositories struct {
+					Edges    []TeamRepoNameEdge
+					PageInfo struct {
+						EndCursor   string
+						HasNextPage bool
+					}
+				} `graphql:"repositories(first: 100)"`
+			}
+			PageInfo struct {
+				EndCursor   string
+				HasNextPage bool
+			}
+		} `graphql:"teams(first: 100, after: $endCursor)"`
 	} `graphql:"organization(login: $owner)"`
 }
 
+// TeamRepoEdge is a repository a team has access to, with the team's
+// permission on it such as ADMIN or WRITE.
+type TeamRepoEdge struct {
+	Permission string
+	Node       RepoInfo
+}
+
+// TeamRepoNameEdge is a repository a team has access to, with only its name,
+// so that the repositories of a page of teams stay within the node limit of
+// a query.
+type TeamRepoNameEdge struct {
+	Permission string
+	Node       struct {
+		Name string
+	}
+}
+
+type RepoWithRules struct {
+	RepoInfo
+	BranchProtectionRules struct {
+		Nodes    []BranchProtectionRule
+		PageInfo struct {
+			EndCursor   string
+			HasNextPage bool
+		}
+	} `graphql:"branchProtectionRules(first: $rulesFirst)"`
+}
+
 type RepoInfo struct {
-	DatabaseId int    `json:"databaseId"`
-	Name       string `json:"name"`
-	Visibility string `json:"visibility"`
+	DatabaseId       int       `json:"databaseId"`
+	Id               string    `json:"id"`
+	Name             string    `json:"name"`
+	Url              string    `json:"url"`
+	Visibility       string    `json:"visibility"`
+	IsArchived       bool      `json:"isArchived"`
+	IsFork           bool      `json:"isFork"`
+	PushedAt         time.Time `json:"pushedAt"`
+	DefaultBranchRef struct {
+		Name string `json:"name"`
+	} `json:"defaultBranchRef"`
+	PrimaryLanguage struct {
+		Name string `json:"name"`
+	} `json:"primaryLanguage"`
+	RepositoryTopics struct {
+		Nodes []struct {
+			Topic struct {
+				Name string `json:"name"`
+			} `json:"topic"`
+		} `json:"nodes"`
+	} `json:"repositoryTopics" graphql:"repositoryTopics(first: 100)"`
+}
+
+// RepoPropertyValues holds the custom property values of a repository, as
+// returned by the REST API.
+type RepoPropertyValues struct {
+	RepositoryId   int    `json:"repository_id"`
+	RepositoryName string `json:"repository_name"`
+	Properties     []struct {
+		PropertyName string      `json:"property_name"`
+		Value        interface{} `json:"value"`
+	} `json:"properties"`
 }
 
 type BranchProtectionRulesQuery struct {
+	RateLimit  RateLimit `graphql:"rateLimit"`
 	Repository struct {
 		BranchProtectionRules struct {
 			Nodes    []BranchProtectionRule
@@ -54,10 +199,24 @@ type BranchProtectionRule struct {
 	RequiresStrictStatusChecks     bool   `json:"requiresStrictStatusChecks"`
 	RestrictsPushes                bool   `json:"restrictsPushes"`
 	RestrictsReviewDismissals      bool   `json:"restrictsReviewDismissals"`
+	// RequiredStatusCheckContexts is only read from GitHub, it is not a
+	// column of the report
+	RequiredStatusCheckContexts []string `json:"requiredStatusCheckContexts"`
 }
 
 type RepoSingleQuery struct {
-	Repository RepoInfo `graphql:"repository(owner: $owner, name: $name)"`
+	RateLimit  RateLimit `graphql:"rateLimit"`
+	Repository RepoInfo  `graphql:"repository(owner: $owner, name: $name)"`
+}
+
+type BranchProtectionRuleNodeQuery struct {
+	RateLimit RateLimit `graphql:"rateLimit"`
+	Node      struct {
+		BranchProtectionRule struct {
+			BranchProtectionRule
+			Repository RepoInfo
+		} `graphql:"... on BranchProtectionRule"`
+	} `graphql:"node(id: $id)"`
 }
 
 type MutationBranchProtection struct {
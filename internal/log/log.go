@@ -6,18 +6,19 @@ import (
 
 func NewLogger(debug bool) (*zap.Logger, error) {
 
-	level := zap.InfoLevel
+	level := zap.WarnLevel
 
 	if debug {
 		level = zap.DebugLevel
 	}
 
 	loggerConfig := zap.Config{
-		Level:            zap.NewAtomicLevelAt(level),
-		Encoding:         "console",
-		EncoderConfig:    zap.NewDevelopmentEncoderConfig(),
-		OutputPaths:      []string{"stderr"},
-		ErrorOutputPaths: []string{"stderr"},
+		Level:             zap.NewAtomicLevelAt(level),
+		Encoding:          "console",
+		EncoderConfig:     zap.NewDevelopmentEncoderConfig(),
+		DisableStacktrace: !debug,
+		OutputPaths:       []string{"stderr"},
+		ErrorOutputPaths:  []string{"stderr"},
 	}
 
 	return loggerConfig.Build()
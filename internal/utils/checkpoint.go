@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// Checkpoint records the progress of a list run so that an interrupted run
+// can be resumed. Owner is the owner or enterprise being listed, and
+// Organizations holds the owners that were fully written to the report when
+// a run lists several. Cursor is the end cursor of the last page of the
+// current owner's repositories that was fully written to the report, and
+// Completed holds the repositories written since then. A nil Checkpoint
+// records nothing.
+type Checkpoint struct {
+	Owner         string   `json:"owner"`
+	OutputFile    string   `json:"outputFile"`
+	Organizations []string `json:"organizations,omitempty"`
+	Cursor        *string  `json:"cursor"`
+	Completed     []string `json:"completed"`
+
+	fileName  string
+	completed map[string]bool
+}
+
+func NewCheckpoint(fileName string, owner string, outputFile string) *Checkpoint {
+	return &Checkpoint{
+		Owner:      owner,
+		OutputFile: outputFile,
+		fileName:   fileName,
+		completed:  make(map[string]bool),
+	}
+}
+
+func LoadCheckpoint(fileName string) (*Checkpoint, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint := &Checkpoint{}
+	if err := json.Unmarshal(content, checkpoint); err != nil {
+		return nil, err
+	}
+	checkpoint.fileName = fileName
+	checkpoint.completed = make(map[string]bool, len(checkpoint.Completed))
+	for _, repo := range checkpoint.Completed {
+		checkpoint.completed[repo] = true
+	}
+	return checkpoint, nil
+}
+
+// IsCompleted reports whether the repository was written to the report after
+// the checkpoint's cursor.
+func (c *Checkpoint) IsCompleted(repo string) bool {
+	return c != nil && c.completed[repo]
+}
+
+// Complete records that every rule of the repository has been written.
+func (c *Checkpoint) Complete(repo string) error {
+	if c == nil {
+		return nil
+	}
+	c.completed[repo] = true
+	c.Completed = append(c.Completed, repo)
+	return c.save()
+}
+
+// NextPage records that every repository up to endCursor has been written.
+func (c *Checkpoint) NextPage(endCursor string) error {
+	if c == nil {
+		return nil
+	}
+	c.Cursor = &endCursor
+	c.Completed = []string{}
+	c.completed = make(map[string]bool)
+	return c.save()
+}
+
+// IsOrganizationCompleted reports whether every repository of the owner was
+// written to the report.
+func (c *Checkpoint) IsOrganizationCompleted(owner string) bool {
+	if c == nil {
+		return false
+	}
+	for _, completed := range c.Organizations {
+		if completed == owner {
+			return true
+		}
+	}
+	return false
+}
+
+// CompleteOrganization records that every repository of the owner has been
+// written, and starts the next owner from its first page.
+func (c *Checkpoint) CompleteOrganization(owner string) error {
+	if c == nil {
+		return nil
+	}
+	c.Organizations = append(c.Organizations, owner)
+	c.Cursor = nil
+	c.Completed = []string{}
+	c.completed = make(map[string]bool)
+	return c.save()
+}
+
+// Remove deletes the checkpoint file once the run has finished.
+func (c *Checkpoint) Remove() error {
+	if c == nil {
+		return nil
+	}
+	return os.Remove(c.fileName)
+}
+
+// save replaces the checkpoint file in a single rename so that an
+// interruption never leaves it half written.
+func (c *Checkpoint) save() error {
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.fileName), filepath.Base(c.fileName)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.fileName)
+}
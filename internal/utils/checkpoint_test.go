@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "state.json")
+	checkpoint := NewCheckpoint(fileName, "my-enterprise", "report.csv")
+
+	steps := []struct {
+		name string
+		step func() error
+	}{
+		{"complete repo-a", func() error { return checkpoint.Complete("repo-a") }},
+		{"next page", func() error { return checkpoint.NextPage("cursor-1") }},
+		{"complete repo-b", func() error { return checkpoint.Complete("repo-b") }},
+		{"complete org-a", func() error { return checkpoint.CompleteOrganization("org-a") }},
+		{"complete repo-c", func() error { return checkpoint.Complete("repo-c") }},
+	}
+	tests := []struct {
+		owner          string
+		cursor         string
+		completed      []string
+		notCompleted   []string
+		orgsCompleted  []string
+		orgsNotStarted []string
+	}{
+		{completed: []string{"repo-a"}, notCompleted: []string{"repo-b"}, orgsNotStarted: []string{"org-a"}},
+		{cursor: "cursor-1", notCompleted: []string{"repo-a"}},
+		{cursor: "cursor-1", completed: []string{"repo-b"}, notCompleted: []string{"repo-a"}},
+		{notCompleted: []string{"repo-b"}, orgsCompleted: []string{"org-a"}, orgsNotStarted: []string{"org-b"}},
+		{completed: []string{"repo-c"}, orgsCompleted: []string{"org-a"}},
+	}
+
+	for i, s := range steps {
+		if err := s.step(); err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+
+		// Every step is saved, so that the run resumes from it
+		loaded, err := LoadCheckpoint(fileName)
+		if err != nil {
+			t.Fatalf("%s: LoadCheckpoint() error = %v", s.name, err)
+		}
+		want := tests[i]
+		if loaded.Owner != "my-enterprise" || loaded.OutputFile != "report.csv" {
+			t.Errorf("%s: loaded owner %q and output file %q", s.name, loaded.Owner, loaded.OutputFile)
+		}
+		cursor := ""
+		if loaded.Cursor != nil {
+			cursor = *loaded.Cursor
+		}
+		if cursor != want.cursor {
+			t.Errorf("%s: cursor = %q, want %q", s.name, cursor, want.cursor)
+		}
+		for _, repo := range want.completed {
+			if !loaded.IsCompleted(repo) {
+				t.Errorf("%s: %s is not completed", s.name, repo)
+			}
+		}
+		for _, repo := range want.notCompleted {
+			if loaded.IsCompleted(repo) {
+				t.Errorf("%s: %s is completed", s.name, repo)
+			}
+		}
+		for _, owner := range want.orgsCompleted {
+			if !loaded.IsOrganizationCompleted(owner) {
+				t.Errorf("%s: organization %s is not completed", s.name, owner)
+			}
+		}
+		for _, owner := range want.orgsNotStarted {
+			if loaded.IsOrganizationCompleted(owner) {
+				t.Errorf("%s: organization %s is completed", s.name, owner)
+			}
+		}
+	}
+
+	if err := checkpoint.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fileName); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("checkpoint file remains after Remove: %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(fileName)); len(entries) > 0 {
+		t.Errorf("temporary files remain: %v", entries)
+	}
+}
+
+func TestNilCheckpoint(t *testing.T) {
+	var checkpoint *Checkpoint
+	if err := checkpoint.Complete("repo-a"); err != nil {
+		t.Errorf("Complete() error = %v", err)
+	}
+	if err := checkpoint.NextPage("cursor-1"); err != nil {
+		t.Errorf("NextPage() error = %v", err)
+	}
+	if err := checkpoint.CompleteOrganization("org-a"); err != nil {
+		t.Errorf("CompleteOrganization() error = %v", err)
+	}
+	if checkpoint.IsCompleted("repo-a") || checkpoint.IsOrganizationCompleted("org-a") {
+		t.Errorf("nil checkpoint records progress")
+	}
+	if err := checkpoint.Remove(); err != nil {
+		t.Errorf("Remove() error = %v", err)
+	}
+}
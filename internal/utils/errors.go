@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cli/go-gh/v2/pkg/api"
+)
+
+// RepoError records an API operation that failed for a single repository.
+type RepoError struct {
+	Repository string `json:"repository"`
+	Operation  string `json:"operation"`
+	Type       string `json:"type"`
+	Message    string `json:"message"`
+}
+
+func NewRepoError(repo string, operation string, err error) RepoError {
+	return RepoError{
+		Repository: repo,
+		Operation:  operation,
+		Type:       errorType(err),
+		Message:    err.Error(),
+	}
+}
+
+// errorType returns the GraphQL error type, such as NOT_FOUND or FORBIDDEN,
+// or the HTTP status for errors returned without one.
+func errorType(err error) string {
+	var gqlErr *api.GraphQLError
+	if errors.As(err, &gqlErr) {
+		for _, item := range gqlErr.Errors {
+			if item.Type != "" {
+				return item.Type
+			}
+		}
+	}
+	var httpErr *api.HTTPError
+	if errors.As(err, &httpErr) {
+		return fmt.Sprintf("HTTP %d", httpErr.StatusCode)
+	}
+	if statusCode, ok := graphQLStatusCode(err); ok {
+		return fmt.Sprintf("HTTP %d", statusCode)
+	}
+	return ""
+}
+
+// graphQLStatusCode returns the HTTP status code of an unsuccessful GraphQL
+// response, which go-gh reports without a typed error.
+func graphQLStatusCode(err error) (int, bool) {
+	var statusCode int
+	if _, err := fmt.Sscanf(err.Error(), "non-200 OK status code: %d", &statusCode); err != nil {
+		return 0, false
+	}
+	return statusCode, true
+}
+
+// WriteRepoErrors writes repository errors to fileName as JSON if it has a
+// .json extension, and as CSV otherwise.
+func WriteRepoErrors(fileName string, repoErrors []RepoError) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(fileName), ".json") {
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(repoErrors); err != nil {
+			return err
+		}
+		return f.Close()
+	}
+
+	csvWriter := csv.NewWriter(f)
+	err = csvWriter.Write([]string{
+		"RepositoryName",
+		"Operation",
+		"ErrorType",
+		"Message",
+	})
+	if err != nil {
+		return err
+	}
+	for _, repoError := range repoErrors {
+		err = csvWriter.Write([]string{
+			repoError.Repository,
+			repoError.Operation,
+			repoError.Type,
+			repoError.Message,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
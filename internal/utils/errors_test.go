@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cli/go-gh/v2/pkg/api"
+)
+
+func TestErrorType(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "GraphQL error", err: &api.GraphQLError{Errors: []api.GraphQLErrorItem{{Type: "NOT_FOUND", Message: "Could not resolve"}}}, want: "NOT_FOUND"},
+		{name: "wrapped GraphQL error", err: fmt.Errorf("getRepo: %w", &api.GraphQLError{Errors: []api.GraphQLErrorItem{{Message: "no type"}, {Type: "FORBIDDEN"}}}), want: "FORBIDDEN"},
+		{name: "HTTP error", err: &api.HTTPError{StatusCode: 404}, want: "HTTP 404"},
+		{name: "GraphQL status", err: errors.New("non-200 OK status code: 502 Bad Gateway body: \"\""), want: "HTTP 502"},
+		{name: "other error", err: errors.New("connection reset by peer")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorType(tt.err); got != tt.want {
+				t.Errorf("errorType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphQLStatusCode(t *testing.T) {
+	tests := []struct {
+		err    error
+		want   int
+		wantOK bool
+	}{
+		{err: errors.New("non-200 OK status code: 502 Bad Gateway body: \"\""), want: 502, wantOK: true},
+		{err: errors.New("Could not resolve to a Repository")},
+		{err: errors.New("status code: 502")},
+	}
+
+	for _, tt := range tests {
+		got, ok := graphQLStatusCode(tt.err)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("graphQLStatusCode(%q) = %d, %v, want %d, %v", tt.err, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
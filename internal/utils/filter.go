@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/katiem0/gh-branch-rules/internal/data"
+)
+
+// RepoFilter selects repositories by their metadata. Every set field must
+// match, and the zero RepoFilter matches every repository.
+type RepoFilter struct {
+	Visibility      string
+	ExcludeArchived bool
+	ExcludeForks    bool
+	Topics          []string
+	Language        string
+	NameRegex       *regexp.Regexp
+	PushedSince     time.Time
+}
+
+// Match reports whether the repository is selected by the filter.
+func (f RepoFilter) Match(repo data.RepoInfo) bool {
+	if f.Visibility != "" && !strings.EqualFold(repo.Visibility, f.Visibility) {
+		return false
+	}
+	if f.ExcludeArchived && repo.IsArchived {
+		return false
+	}
+	if f.ExcludeForks && repo.IsFork {
+		return false
+	}
+	for _, topic := range f.Topics {
+		if !hasTopic(repo, topic) {
+			return false
+		}
+	}
+	if f.Language != "" && !strings.EqualFold(repo.PrimaryLanguage.Name, f.Language) {
+		return false
+	}
+	if f.NameRegex != nil && !f.NameRegex.MatchString(repo.Name) {
+		return false
+	}
+	if !f.PushedSince.IsZero() && repo.PushedAt.Before(f.PushedSince) {
+		return false
+	}
+	return true
+}
+
+func hasTopic(repo data.RepoInfo, topic string) bool {
+	for _, node := range repo.RepositoryTopics.Nodes {
+		if strings.EqualFold(node.Topic.Name, topic) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/katiem0/gh-branch-rules/internal/data"
+)
+
+func TestRepoFilterMatch(t *testing.T) {
+	repo := data.RepoInfo{
+		Name:       "payments-api",
+		Visibility: "PRIVATE",
+		PushedAt:   time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+	repo.PrimaryLanguage.Name = "Go"
+	repo.RepositoryTopics.Nodes = make([]struct {
+		Topic struct {
+			Name string `json:"name"`
+		} `json:"topic"`
+	}, 2)
+	repo.RepositoryTopics.Nodes[0].Topic.Name = "payments"
+	repo.RepositoryTopics.Nodes[1].Topic.Name = "production"
+
+	archived := repo
+	archived.IsArchived = true
+	fork := repo
+	fork.IsFork = true
+	neverPushed := repo
+	neverPushed.PushedAt = time.Time{}
+
+	tests := []struct {
+		name   string
+		filter RepoFilter
+		repo   data.RepoInfo
+		want   bool
+	}{
+		{name: "zero filter", repo: repo, want: true},
+		{name: "zero filter selects archived", repo: archived, want: true},
+		{name: "visibility regardless of case", filter: RepoFilter{Visibility: "private"}, repo: repo, want: true},
+		{name: "other visibility", filter: RepoFilter{Visibility: "public"}, repo: repo},
+		{name: "archived excluded", filter: RepoFilter{ExcludeArchived: true}, repo: archived},
+		{name: "fork excluded", filter: RepoFilter{ExcludeForks: true}, repo: fork},
+		{name: "every topic", filter: RepoFilter{Topics: []string{"Payments", "production"}}, repo: repo, want: true},
+		{name: "missing topic", filter: RepoFilter{Topics: []string{"payments", "staging"}}, repo: repo},
+		{name: "language regardless of case", filter: RepoFilter{Language: "go"}, repo: repo, want: true},
+		{name: "other language", filter: RepoFilter{Language: "Python"}, repo: repo},
+		{name: "name regex", filter: RepoFilter{NameRegex: regexp.MustCompile(`-api$`)}, repo: repo, want: true},
+		{name: "name regex not matching", filter: RepoFilter{NameRegex: regexp.MustCompile(`^web-`)}, repo: repo},
+		{name: "pushed since", filter: RepoFilter{PushedSince: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)}, repo: repo, want: true},
+		{name: "pushed before", filter: RepoFilter{PushedSince: time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)}, repo: repo},
+		{name: "never pushed", filter: RepoFilter{PushedSince: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)}, repo: neverPushed},
+		{
+			name:   "every field must match",
+			filter: RepoFilter{Visibility: "private", Language: "Go", ExcludeArchived: true},
+			repo:   archived,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tt.repo); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
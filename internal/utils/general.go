@@ -1,6 +1,10 @@
 package utils
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
 	"strconv"
 
 	"github.com/cli/go-gh/v2/pkg/api"
@@ -8,6 +12,34 @@ import (
 	"github.com/shurcooL/graphql"
 )
 
+// BranchRulesHeader is the column layout written by list and read by update.
+var BranchRulesHeader = []string{
+	"RepositoryName",
+	"RepositoryID",
+	"BranchProtectionRulePattern",
+	"BranchProtectionRuleId",
+	"AllowsDeletions",
+	"AllowsForcePushes",
+	"BlockCreations",
+	"DismissesStaleReviews",
+	"IsAdminEnforced",
+	"LockAllowsFetchAndMerge",
+	"LockBranch",
+	"RequireLastPushApproval",
+	"RequiredApprovingReviewCount",
+	"RequiresApprovingReviews",
+	"RequiresCodeOwnerReviews",
+	"RequiresCommitSignatures",
+	"RequiresConversationResolution",
+	"RequiresDeployments",
+	"RequiresLinearHistory",
+	"RequiresStatusChecks",
+	"RequiresStrictStatusChecks",
+	"RestrictsPushes",
+	"RestrictsReviewDismissals",
+	"Fingerprint",
+}
+
 type Getter interface {
 	GetRepo(owner string, name string) ([]data.RepoSingleQuery, error)
 	GetReposList(owner string, endCursor *string) ([]data.ReposQuery, error)
@@ -15,15 +47,70 @@ type Getter interface {
 	UpdateBranchProtectionPolicies(branchPolicy data.BranchProtectionRule) error
 }
 
+// APIGetter is safe for concurrent use by multiple goroutines; the underlying
+// clients share a single http.Client and hold no per-request state.
 type APIGetter struct {
-	gqlClient  api.GraphQLClient
-	restClient api.RESTClient
+	gqlClient   *api.GraphQLClient
+	restClient  *api.RESTClient
+	rateLimiter *RateLimiter
+	maxRetries  int
 }
 
-func NewAPIGetter(gqlClient *api.GraphQLClient, restClient *api.RESTClient) *APIGetter {
+func NewAPIGetter(gqlClient *api.GraphQLClient, restClient *api.RESTClient, rateLimiter *RateLimiter, maxRetries int) *APIGetter {
 	return &APIGetter{
-		gqlClient:  *gqlClient,
-		restClient: *restClient,
+		gqlClient:   gqlClient,
+		restClient:  restClient,
+		rateLimiter: rateLimiter,
+		maxRetries:  maxRetries,
+	}
+}
+
+// GetOwnerType returns Organization or User for the owner of repositories.
+func (g *APIGetter) GetOwnerType(owner string) (string, error) {
+	query := new(data.OwnerQuery)
+	variables := map[string]interface{}{
+		"owner": graphql.String(owner),
+	}
+
+	err := g.withRetry("getOwner", isTransientError, func() error {
+		return g.gqlClient.Query("getOwner", &query, variables)
+	})
+	if err != nil {
+		return "", err
+	}
+	g.rateLimiter.Observe(query.RateLimit)
+	if query.RepositoryOwner.Typename == "" {
+		return "", fmt.Errorf("no organization or user named %s was found", owner)
+	}
+	return query.RepositoryOwner.Typename, nil
+}
+
+// GetEnterpriseOrgs returns the login of every organization in an enterprise.
+func (g *APIGetter) GetEnterpriseOrgs(slug string) ([]string, error) {
+	var orgs []string
+	var endCursor *string
+	for {
+		query := new(data.EnterpriseOrgsQuery)
+		variables := map[string]interface{}{
+			"endCursor": (*graphql.String)(endCursor),
+			"slug":      graphql.String(slug),
+		}
+
+		err := g.withRetry("getEnterpriseOrgs", isTransientError, func() error {
+			return g.gqlClient.Query("getEnterpriseOrgs", &query, variables)
+		})
+		if err != nil {
+			return nil, err
+		}
+		g.rateLimiter.Observe(query.RateLimit)
+
+		for _, org := range query.Enterprise.Organizations.Nodes {
+			orgs = append(orgs, org.Login)
+		}
+		if !query.Enterprise.Organizations.PageInfo.HasNextPage {
+			return orgs, nil
+		}
+		endCursor = &query.Enterprise.Organizations.PageInfo.EndCursor
 	}
 }
 
@@ -34,7 +121,30 @@ func (g *APIGetter) GetReposList(owner string, endCursor *string) (*data.ReposQu
 		"owner":     graphql.String(owner),
 	}
 
-	err := g.gqlClient.Query("getRepos", &query, variables)
+	err := g.withRetry("getRepos", isTransientError, func() error {
+		return g.gqlClient.Query("getRepos", &query, variables)
+	})
+	if err == nil {
+		g.rateLimiter.Observe(query.RateLimit)
+	}
+
+	return query, err
+}
+
+func (g *APIGetter) GetReposListWithRules(owner string, rulesFirst int, endCursor *string) (*data.ReposWithRulesQuery, error) {
+	query := new(data.ReposWithRulesQuery)
+	variables := map[string]interface{}{
+		"endCursor":  (*graphql.String)(endCursor),
+		"owner":      graphql.String(owner),
+		"rulesFirst": graphql.Int(rulesFirst),
+	}
+
+	err := g.withRetry("getReposWithRules", isTransientError, func() error {
+		return g.gqlClient.Query("getReposWithRules", &query, variables)
+	})
+	if err == nil {
+		g.rateLimiter.Observe(query.RateLimit)
+	}
 
 	return query, err
 }
@@ -46,7 +156,12 @@ func (g *APIGetter) GetRepo(owner string, name string) (*data.RepoSingleQuery, e
 		"name":  graphql.String(name),
 	}
 
-	err := g.gqlClient.Query("getRepo", &query, variables)
+	err := g.withRetry("getRepo", isTransientError, func() error {
+		return g.gqlClient.Query("getRepo", &query, variables)
+	})
+	if err == nil {
+		g.rateLimiter.Observe(query.RateLimit)
+	}
 	return query, err
 }
 
@@ -58,41 +173,274 @@ func (g *APIGetter) GetBranchProtections(owner string, name string, endCursor *s
 		"name":      graphql.String(name),
 	}
 
-	err := g.gqlClient.Query("getBranchProtectionPolicies", &query, variables)
+	err := g.withRetry("getBranchProtectionPolicies", isTransientError, func() error {
+		return g.gqlClient.Query("getBranchProtectionPolicies", &query, variables)
+	})
+	if err == nil {
+		g.rateLimiter.Observe(query.RateLimit)
+	}
+
+	return query, err
+}
+
+// GetTeamRepos returns a page of the repositories a team has access to.
+func (g *APIGetter) GetTeamRepos(owner string, slug string, endCursor *string) (*data.TeamReposQuery, error) {
+	query := new(data.TeamReposQuery)
+	variables := map[string]interface{}{
+		"endCursor": (*graphql.String)(endCursor),
+		"owner":     graphql.String(owner),
+		"slug":      graphql.String(slug),
+	}
+
+	err := g.withRetry("getTeamRepos", isTransientError, func() error {
+		return g.gqlClient.Query("getTeamRepos", &query, variables)
+	})
+	if err == nil {
+		g.rateLimiter.Observe(query.RateLimit)
+		if query.Organization.Team.Slug == "" {
+			err = fmt.Errorf("team %s not found in %s", slug, owner)
+		}
+	}
+
+	return query, err
+}
+
+// GetTeams returns a page of the teams in an organization, with the first
+// page of repositories each team has access to.
+func (g *APIGetter) GetTeams(owner string, endCursor *string) (*data.TeamsQuery, error) {
+	query := new(data.TeamsQuery)
+	variables := map[string]interface{}{
+		"endCursor": (*graphql.String)(endCursor),
+		"owner":     graphql.String(owner),
+	}
+
+	err := g.withRetry("getTeams", isTransientError, func() error {
+		return g.gqlClient.Query("getTeams", &query, variables)
+	})
+	if err == nil {
+		g.rateLimiter.Observe(query.RateLimit)
+	}
 
 	return query, err
 }
 
+// GetRepoProperties returns the custom property values of every repository
+// in an organization.
+func (g *APIGetter) GetRepoProperties(owner string) ([]data.RepoPropertyValues, error) {
+	var allValues []data.RepoPropertyValues
+	for page := 1; ; page++ {
+		var values []data.RepoPropertyValues
+		path := fmt.Sprintf("orgs/%s/properties/values?per_page=100&page=%d", owner, page)
+		err := g.withRetry("getRepoProperties", isTransientError, func() error {
+			return g.restClient.Get(path, &values)
+		})
+		if err != nil {
+			return nil, err
+		}
+		allValues = append(allValues, values...)
+		if len(values) < 100 {
+			return allValues, nil
+		}
+	}
+}
+
+// GetBranchProtectionRule returns the current settings of a rule and its
+// repository by the rule's node ID.
+func (g *APIGetter) GetBranchProtectionRule(id string) (*data.BranchProtectionRuleNodeQuery, error) {
+	query := new(data.BranchProtectionRuleNodeQuery)
+	variables := map[string]interface{}{
+		"id": graphql.ID(id),
+	}
+
+	err := g.withRetry("getBranchProtectionRule", isTransientError, func() error {
+		return g.gqlClient.Query("getBranchProtectionRule", &query, variables)
+	})
+	if err == nil {
+		g.rateLimiter.Observe(query.RateLimit)
+		if query.Node.BranchProtectionRule.ID == "" {
+			err = fmt.Errorf("branch protection rule %s not found", id)
+		}
+	}
+
+	return query, err
+}
+
+// ruleColumns parse each settings column of a branch protection rules file
+// into a rule. Values are checked by ValidateBranchProtectionPolicyData.
+var ruleColumns = map[string]func(rule *data.BranchProtectionRule, value string){
+	"BranchProtectionRulePattern": func(rule *data.BranchProtectionRule, value string) { rule.Pattern = value },
+	"BranchProtectionRuleId":      func(rule *data.BranchProtectionRule, value string) { rule.ID = value },
+	"AllowsDeletions": func(rule *data.BranchProtectionRule, value string) {
+		rule.AllowsDeletions, _ = strconv.ParseBool(value)
+	},
+	"AllowsForcePushes": func(rule *data.BranchProtectionRule, value string) {
+		rule.AllowsForcePushes, _ = strconv.ParseBool(value)
+	},
+	"BlockCreations": func(rule *data.BranchProtectionRule, value string) {
+		rule.BlocksCreations, _ = strconv.ParseBool(value)
+	},
+	"DismissesStaleReviews": func(rule *data.BranchProtectionRule, value string) {
+		rule.DismissesStaleReviews, _ = strconv.ParseBool(value)
+	},
+	"IsAdminEnforced": func(rule *data.BranchProtectionRule, value string) {
+		rule.IsAdminEnforced, _ = strconv.ParseBool(value)
+	},
+	"LockAllowsFetchAndMerge": func(rule *data.BranchProtectionRule, value string) {
+		rule.LockAllowsFetchAndMerge, _ = strconv.ParseBool(value)
+	},
+	"LockBranch": func(rule *data.BranchProtectionRule, value string) { rule.LockBranch, _ = strconv.ParseBool(value) },
+	"RequireLastPushApproval": func(rule *data.BranchProtectionRule, value string) {
+		rule.RequireLastPushApproval, _ = strconv.ParseBool(value)
+	},
+	"RequiredApprovingReviewCount": func(rule *data.BranchProtectionRule, value string) {
+		rule.RequiredApprovingReviewCount, _ = strconv.Atoi(value)
+	},
+	"RequiresApprovingReviews": func(rule *data.BranchProtectionRule, value string) {
+		rule.RequiresApprovingReviews, _ = strconv.ParseBool(value)
+	},
+	"RequiresCodeOwnerReviews": func(rule *data.BranchProtectionRule, value string) {
+		rule.RequiresCodeOwnerReviews, _ = strconv.ParseBool(value)
+	},
+	"RequiresCommitSignatures": func(rule *data.BranchProtectionRule, value string) {
+		rule.RequiresCommitSignatures, _ = strconv.ParseBool(value)
+	},
+	"RequiresConversationResolution": func(rule *data.BranchProtectionRule, value string) {
+		rule.RequiresConversationResolution, _ = strconv.ParseBool(value)
+	},
+	"RequiresDeployments": func(rule *data.BranchProtectionRule, value string) {
+		rule.RequiresDeployments, _ = strconv.ParseBool(value)
+	},
+	"RequiresLinearHistory": func(rule *data.BranchProtectionRule, value string) {
+		rule.RequiresLinearHistory, _ = strconv.ParseBool(value)
+	},
+	"RequiresStatusChecks": func(rule *data.BranchProtectionRule, value string) {
+		rule.RequiresStatusChecks, _ = strconv.ParseBool(value)
+	},
+	"RequiresStrictStatusChecks": func(rule *data.BranchProtectionRule, value string) {
+		rule.RequiresStrictStatusChecks, _ = strconv.ParseBool(value)
+	},
+	"RestrictsPushes": func(rule *data.BranchProtectionRule, value string) {
+		rule.RestrictsPushes, _ = strconv.ParseBool(value)
+	},
+	"RestrictsReviewDismissals": func(rule *data.BranchProtectionRule, value string) {
+		rule.RestrictsReviewDismissals, _ = strconv.ParseBool(value)
+	},
+}
+
+// CreateBranchProtectionPolicyData parses each row of a branch protection
+// rules file, header included, into a rule. Settings without a column in the
+// file are left unset.
 func CreateBranchProtectionPolicyData(fileData [][]string) []data.BranchProtectionRule {
 	var importBranchRules []data.BranchProtectionRule
-	var branchPolicy data.BranchProtectionRule
+	col := HeaderIndex(fileData[0])
 	for _, each := range fileData[1:] {
-		branchPolicy.Pattern = each[2]
-		branchPolicy.ID = each[3]
-		branchPolicy.AllowsDeletions, _ = strconv.ParseBool(each[4])
-		branchPolicy.AllowsForcePushes, _ = strconv.ParseBool(each[5])
-		branchPolicy.BlocksCreations, _ = strconv.ParseBool(each[6])
-		branchPolicy.DismissesStaleReviews, _ = strconv.ParseBool(each[7])
-		branchPolicy.IsAdminEnforced, _ = strconv.ParseBool(each[8])
-		branchPolicy.LockAllowsFetchAndMerge, _ = strconv.ParseBool(each[9])
-		branchPolicy.LockBranch, _ = strconv.ParseBool(each[10])
-		branchPolicy.RequireLastPushApproval, _ = strconv.ParseBool(each[11])
-		branchPolicy.RequiredApprovingReviewCount, _ = strconv.Atoi(each[12])
-		branchPolicy.RequiresApprovingReviews, _ = strconv.ParseBool(each[13])
-		branchPolicy.RequiresCodeOwnerReviews, _ = strconv.ParseBool(each[14])
-		branchPolicy.RequiresCommitSignatures, _ = strconv.ParseBool(each[15])
-		branchPolicy.RequiresConversationResolution, _ = strconv.ParseBool(each[16])
-		branchPolicy.RequiresDeployments, _ = strconv.ParseBool(each[17])
-		branchPolicy.RequiresLinearHistory, _ = strconv.ParseBool(each[18])
-		branchPolicy.RequiresStatusChecks, _ = strconv.ParseBool(each[19])
-		branchPolicy.RequiresStrictStatusChecks, _ = strconv.ParseBool(each[20])
-		branchPolicy.RestrictsPushes, _ = strconv.ParseBool(each[21])
-		branchPolicy.RestrictsReviewDismissals, _ = strconv.ParseBool(each[22])
+		var branchPolicy data.BranchProtectionRule
+		ApplyBranchProtectionRecord(&branchPolicy, col, each)
 		importBranchRules = append(importBranchRules, branchPolicy)
 	}
 	return importBranchRules
 }
 
+// ApplyBranchProtectionRecord sets the settings of rule that have a column in
+// col to their values in record, leaving the others as they are.
+func ApplyBranchProtectionRecord(rule *data.BranchProtectionRule, col map[string]int, record []string) {
+	for name, set := range ruleColumns {
+		if i, ok := col[name]; ok {
+			set(rule, record[i])
+		}
+	}
+}
+
+// MissingSettingColumns returns the settings columns of BranchRulesHeader
+// that are not in header, in header order.
+func MissingSettingColumns(header []string) []string {
+	col := HeaderIndex(header)
+	var missing []string
+	for _, name := range BranchRulesHeader {
+		if _, ok := col[name]; !ok && ruleColumns[name] != nil {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// BranchProtectionRuleValues formats the settings of a rule keyed by their
+// column name in BranchRulesHeader.
+func BranchProtectionRuleValues(rule data.BranchProtectionRule) map[string]string {
+	return map[string]string{
+		"BranchProtectionRulePattern":    rule.Pattern,
+		"BranchProtectionRuleId":         rule.ID,
+		"AllowsDeletions":                strconv.FormatBool(rule.AllowsDeletions),
+		"AllowsForcePushes":              strconv.FormatBool(rule.AllowsForcePushes),
+		"BlockCreations":                 strconv.FormatBool(rule.BlocksCreations),
+		"DismissesStaleReviews":          strconv.FormatBool(rule.DismissesStaleReviews),
+		"IsAdminEnforced":                strconv.FormatBool(rule.IsAdminEnforced),
+		"LockAllowsFetchAndMerge":        strconv.FormatBool(rule.LockAllowsFetchAndMerge),
+		"LockBranch":                     strconv.FormatBool(rule.LockBranch),
+		"RequireLastPushApproval":        strconv.FormatBool(rule.RequireLastPushApproval),
+		"RequiredApprovingReviewCount":   strconv.Itoa(rule.RequiredApprovingReviewCount),
+		"RequiresApprovingReviews":       strconv.FormatBool(rule.RequiresApprovingReviews),
+		"RequiresCodeOwnerReviews":       strconv.FormatBool(rule.RequiresCodeOwnerReviews),
+		"RequiresCommitSignatures":       strconv.FormatBool(rule.RequiresCommitSignatures),
+		"RequiresConversationResolution": strconv.FormatBool(rule.RequiresConversationResolution),
+		"RequiresDeployments":            strconv.FormatBool(rule.RequiresDeployments),
+		"RequiresLinearHistory":          strconv.FormatBool(rule.RequiresLinearHistory),
+		"RequiresStatusChecks":           strconv.FormatBool(rule.RequiresStatusChecks),
+		"RequiresStrictStatusChecks":     strconv.FormatBool(rule.RequiresStrictStatusChecks),
+		"RestrictsPushes":                strconv.FormatBool(rule.RestrictsPushes),
+		"RestrictsReviewDismissals":      strconv.FormatBool(rule.RestrictsReviewDismissals),
+	}
+}
+
+// BranchProtectionRuleRecord formats a rule as a report row in
+// BranchRulesHeader order.
+func BranchProtectionRuleRecord(repo data.RepoInfo, rule data.BranchProtectionRule) []string {
+	values := BranchProtectionRuleValues(rule)
+	values["RepositoryName"] = repo.Name
+	values["RepositoryID"] = strconv.Itoa(repo.DatabaseId)
+	values["Fingerprint"] = RuleFingerprint(rule)
+
+	record := make([]string, len(BranchRulesHeader))
+	for i, name := range BranchRulesHeader {
+		record[i] = values[name]
+	}
+	return record
+}
+
+// RuleFingerprint returns a stable hash of the settings of a rule, so that a
+// row can be checked against the live rule it was listed from.
+func RuleFingerprint(rule data.BranchProtectionRule) string {
+	values := BranchProtectionRuleValues(rule)
+	delete(values, "BranchProtectionRuleId")
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(hash, "%s=%s\n", name, values[name])
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// ChangedFields returns the columns, in BranchRulesHeader order, whose values
+// differ between the current and desired settings of a rule.
+func ChangedFields(current data.BranchProtectionRule, desired data.BranchProtectionRule) []string {
+	currentValues := BranchProtectionRuleValues(current)
+	desiredValues := BranchProtectionRuleValues(desired)
+
+	var changed []string
+	for _, name := range BranchRulesHeader {
+		if currentValues[name] != desiredValues[name] {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
 func (g *APIGetter) UpdateBranchProtectionPolicies(branchPolicy data.BranchProtectionRule) error {
 	mutation := new(data.MutationBranchProtection)
 	input := data.UpdateBranchProtectionRuleInput{
@@ -122,7 +470,10 @@ func (g *APIGetter) UpdateBranchProtectionPolicies(branchPolicy data.BranchProte
 		"input": input,
 	}
 
-	err := g.gqlClient.Mutate("getBranchProtectionPolicies", &mutation, variables)
+	// The mutation may have been applied unless it never reached GitHub
+	err := g.withRetry("updateBranchProtectionPolicy", isUnsentError, func() error {
+		return g.gqlClient.Mutate("getBranchProtectionPolicies", &mutation, variables)
+	})
 	return err
 
 }
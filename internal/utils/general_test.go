@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/katiem0/gh-branch-rules/internal/data"
+)
+
+func TestChangedFields(t *testing.T) {
+	current := data.BranchProtectionRule{
+		ID:                           "BPR_1",
+		Pattern:                      "main",
+		RequiresApprovingReviews:     true,
+		RequiredApprovingReviewCount: 1,
+	}
+
+	tests := []struct {
+		name   string
+		change func(rule *data.BranchProtectionRule)
+		want   []string
+	}{
+		{name: "unchanged", change: func(rule *data.BranchProtectionRule) {}},
+		{
+			name:   "status check contexts are not compared",
+			change: func(rule *data.BranchProtectionRule) { rule.RequiredStatusCheckContexts = []string{"ci"} },
+		},
+		{
+			name: "settings in header order",
+			change: func(rule *data.BranchProtectionRule) {
+				rule.RestrictsPushes = true
+				rule.RequiredApprovingReviewCount = 2
+				rule.AllowsDeletions = true
+			},
+			want: []string{"AllowsDeletions", "RequiredApprovingReviewCount", "RestrictsPushes"},
+		},
+		{
+			name:   "pattern",
+			change: func(rule *data.BranchProtectionRule) { rule.Pattern = "release/*" },
+			want:   []string{"BranchProtectionRulePattern"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desired := current
+			tt.change(&desired)
+			if got := ChangedFields(current, desired); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ChangedFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleFingerprint(t *testing.T) {
+	rule := data.BranchProtectionRule{
+		ID:                           "BPR_1",
+		Pattern:                      "main",
+		RequiresApprovingReviews:     true,
+		RequiredApprovingReviewCount: 2,
+	}
+	fingerprint := RuleFingerprint(rule)
+	if len(fingerprint) != 16 {
+		t.Fatalf("RuleFingerprint() = %q, want 16 hex characters", fingerprint)
+	}
+
+	tests := []struct {
+		name   string
+		change func(rule *data.BranchProtectionRule)
+		same   bool
+	}{
+		{name: "unchanged", change: func(rule *data.BranchProtectionRule) {}, same: true},
+		{name: "other ID", change: func(rule *data.BranchProtectionRule) { rule.ID = "BPR_2" }, same: true},
+		{name: "status check contexts", change: func(rule *data.BranchProtectionRule) { rule.RequiredStatusCheckContexts = []string{"ci"} }, same: true},
+		{name: "other pattern", change: func(rule *data.BranchProtectionRule) { rule.Pattern = "release/*" }},
+		{name: "boolean setting", change: func(rule *data.BranchProtectionRule) { rule.LockBranch = true }},
+		{name: "review count", change: func(rule *data.BranchProtectionRule) { rule.RequiredApprovingReviewCount = 1 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := rule
+			tt.change(&changed)
+			if got := RuleFingerprint(changed); (got == fingerprint) != tt.same {
+				t.Errorf("RuleFingerprint() = %q, original %q, want same %v", got, fingerprint, tt.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"github.com/katiem0/gh-branch-rules/internal/data"
+)
+
+// LintFinding describes a branch protection setting that is allowed by the
+// API but has no effect, or contradicts another setting on the same rule.
+type LintFinding struct {
+	Name    string
+	Message string
+}
+
+func (f LintFinding) String() string {
+	return f.Name + ": " + f.Message
+}
+
+type lintRule struct {
+	name    string
+	message string
+	// live rules check settings that are read from GitHub but not held in
+	// rules files
+	live    bool
+	matches func(rule data.BranchProtectionRule) bool
+	fix     func(rule *data.BranchProtectionRule)
+}
+
+var lintRules = []lintRule{
+	{
+		name:    "review-count-without-reviews",
+		message: "RequiredApprovingReviewCount is set but RequiresApprovingReviews is false",
+		matches: func(rule data.BranchProtectionRule) bool {
+			return rule.RequiredApprovingReviewCount > 0 && !rule.RequiresApprovingReviews
+		},
+		fix: func(rule *data.BranchProtectionRule) { rule.RequiredApprovingReviewCount = 0 },
+	},
+	{
+		name:    "stale-dismissal-without-reviews",
+		message: "DismissesStaleReviews is true but RequiresApprovingReviews is false",
+		matches: func(rule data.BranchProtectionRule) bool {
+			return rule.DismissesStaleReviews && !rule.RequiresApprovingReviews
+		},
+		fix: func(rule *data.BranchProtectionRule) { rule.DismissesStaleReviews = false },
+	},
+	{
+		name:    "code-owner-reviews-without-reviews",
+		message: "RequiresCodeOwnerReviews is true but RequiresApprovingReviews is false",
+		matches: func(rule data.BranchProtectionRule) bool {
+			return rule.RequiresCodeOwnerReviews && !rule.RequiresApprovingReviews
+		},
+		fix: func(rule *data.BranchProtectionRule) { rule.RequiresCodeOwnerReviews = false },
+	},
+	{
+		name:    "last-push-approval-without-reviews",
+		message: "RequireLastPushApproval is true but RequiresApprovingReviews is false",
+		matches: func(rule data.BranchProtectionRule) bool {
+			return rule.RequireLastPushApproval && !rule.RequiresApprovingReviews
+		},
+		fix: func(rule *data.BranchProtectionRule) { rule.RequireLastPushApproval = false },
+	},
+	{
+		name:    "fetch-and-merge-without-lock",
+		message: "LockAllowsFetchAndMerge is true but LockBranch is false",
+		matches: func(rule data.BranchProtectionRule) bool {
+			return rule.LockAllowsFetchAndMerge && !rule.LockBranch
+		},
+		fix: func(rule *data.BranchProtectionRule) { rule.LockAllowsFetchAndMerge = false },
+	},
+	{
+		name:    "status-checks-without-contexts",
+		message: "RequiresStatusChecks is true but no status checks are required",
+		live:    true,
+		matches: func(rule data.BranchProtectionRule) bool {
+			return rule.RequiresStatusChecks && len(rule.RequiredStatusCheckContexts) == 0
+		},
+		fix: func(rule *data.BranchProtectionRule) { rule.RequiresStatusChecks = false },
+	},
+	{
+		name:    "strict-checks-without-status-checks",
+		message: "RequiresStrictStatusChecks is true but RequiresStatusChecks is false",
+		matches: func(rule data.BranchProtectionRule) bool {
+			return rule.RequiresStrictStatusChecks && !rule.RequiresStatusChecks
+		},
+		fix: func(rule *data.BranchProtectionRule) { rule.RequiresStrictStatusChecks = false },
+	},
+}
+
+// LintBranchProtectionRule returns every contradictory or ineffective setting
+// found on the rule. Checks of settings that are not held in rules files are
+// only made on live rules.
+func LintBranchProtectionRule(rule data.BranchProtectionRule, live bool) []LintFinding {
+	var findings []LintFinding
+	for _, l := range lintRules {
+		if (live || !l.live) && l.matches(rule) {
+			findings = append(findings, LintFinding{Name: l.name, Message: l.message})
+		}
+	}
+	return findings
+}
+
+// FixBranchProtectionRule normalizes the rule by turning off every setting
+// flagged by LintBranchProtectionRule, and returns the findings it fixed.
+func FixBranchProtectionRule(rule *data.BranchProtectionRule, live bool) []LintFinding {
+	var findings []LintFinding
+	for _, l := range lintRules {
+		if (live || !l.live) && l.matches(*rule) {
+			l.fix(rule)
+			findings = append(findings, LintFinding{Name: l.name, Message: l.message})
+		}
+	}
+	return findings
+}
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/katiem0/gh-branch-rules/internal/data"
+)
+
+// findingNames returns the names of the findings in order.
+func findingNames(findings []LintFinding) []string {
+	var names []string
+	for _, finding := range findings {
+		names = append(names, finding.Name)
+	}
+	return names
+}
+
+func TestLintBranchProtectionRule(t *testing.T) {
+	tests := []struct {
+		name string
+		rule data.BranchProtectionRule
+		live bool
+		want []string
+	}{
+		{
+			name: "consistent rule",
+			rule: data.BranchProtectionRule{
+				RequiresApprovingReviews:     true,
+				RequiredApprovingReviewCount: 2,
+				DismissesStaleReviews:        true,
+				RequiresStatusChecks:         true,
+				RequiresStrictStatusChecks:   true,
+				RequiredStatusCheckContexts:  []string{"ci"},
+			},
+			live: true,
+		},
+		{
+			name: "review settings without reviews",
+			rule: data.BranchProtectionRule{
+				RequiredApprovingReviewCount: 1,
+				DismissesStaleReviews:        true,
+				RequiresCodeOwnerReviews:     true,
+				RequireLastPushApproval:      true,
+			},
+			want: []string{"review-count-without-reviews", "stale-dismissal-without-reviews", "code-owner-reviews-without-reviews", "last-push-approval-without-reviews"},
+		},
+		{
+			name: "fetch and merge without lock",
+			rule: data.BranchProtectionRule{LockAllowsFetchAndMerge: true},
+			want: []string{"fetch-and-merge-without-lock"},
+		},
+		{
+			name: "strict checks without status checks",
+			rule: data.BranchProtectionRule{RequiresStrictStatusChecks: true},
+			want: []string{"strict-checks-without-status-checks"},
+		},
+		{
+			name: "status checks without contexts in a file",
+			rule: data.BranchProtectionRule{RequiresStatusChecks: true},
+		},
+		{
+			name: "live status checks without contexts",
+			rule: data.BranchProtectionRule{RequiresStatusChecks: true},
+			live: true,
+			want: []string{"status-checks-without-contexts"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findingNames(LintBranchProtectionRule(tt.rule, tt.live))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LintBranchProtectionRule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFixBranchProtectionRule(t *testing.T) {
+	tests := []struct {
+		name string
+		rule data.BranchProtectionRule
+		live bool
+		want data.BranchProtectionRule
+		// findings are the checks fixed, in order
+		findings []string
+	}{
+		{
+			name: "review settings without reviews",
+			rule: data.BranchProtectionRule{
+				Pattern:                      "main",
+				RequiredApprovingReviewCount: 1,
+				DismissesStaleReviews:        true,
+				RequiresCommitSignatures:     true,
+			},
+			want:     data.BranchProtectionRule{Pattern: "main", RequiresCommitSignatures: true},
+			findings: []string{"review-count-without-reviews", "stale-dismissal-without-reviews"},
+		},
+		{
+			// Turning off status checks leaves strict checks to be fixed in
+			// turn, which lint alone does not report
+			name:     "live status checks without contexts",
+			rule:     data.BranchProtectionRule{RequiresStatusChecks: true, RequiresStrictStatusChecks: true},
+			live:     true,
+			want:     data.BranchProtectionRule{},
+			findings: []string{"status-checks-without-contexts", "strict-checks-without-status-checks"},
+		},
+		{
+			name: "status checks without contexts in a file",
+			rule: data.BranchProtectionRule{RequiresStatusChecks: true, RequiresStrictStatusChecks: true},
+			want: data.BranchProtectionRule{RequiresStatusChecks: true, RequiresStrictStatusChecks: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			findings := findingNames(FixBranchProtectionRule(&rule, tt.live))
+			if !reflect.DeepEqual(findings, tt.findings) {
+				t.Errorf("FixBranchProtectionRule() = %v, want %v", findings, tt.findings)
+			}
+			if !reflect.DeepEqual(rule, tt.want) {
+				t.Errorf("FixBranchProtectionRule() left %+v, want %+v", rule, tt.want)
+			}
+			if remaining := LintBranchProtectionRule(rule, tt.live); len(remaining) > 0 {
+				t.Errorf("fixed rule still has findings %v", remaining)
+			}
+		})
+	}
+}
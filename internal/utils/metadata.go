@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/katiem0/gh-branch-rules/internal/data"
+)
+
+// metadataColumns maps each optional repository metadata column to its value.
+var metadataColumns = map[string]func(repo data.RepoInfo) string{
+	"Visibility":       func(repo data.RepoInfo) string { return strings.ToLower(repo.Visibility) },
+	"Archived":         func(repo data.RepoInfo) string { return strconv.FormatBool(repo.IsArchived) },
+	"Fork":             func(repo data.RepoInfo) string { return strconv.FormatBool(repo.IsFork) },
+	"DefaultBranch":    func(repo data.RepoInfo) string { return repo.DefaultBranchRef.Name },
+	"RepositoryNodeID": func(repo data.RepoInfo) string { return repo.Id },
+	"URL":              func(repo data.RepoInfo) string { return repo.Url },
+	"Language":         func(repo data.RepoInfo) string { return repo.PrimaryLanguage.Name },
+	"Topics": func(repo data.RepoInfo) string {
+		topics := make([]string, len(repo.RepositoryTopics.Nodes))
+		for i, node := range repo.RepositoryTopics.Nodes {
+			topics[i] = node.Topic.Name
+		}
+		return strings.Join(topics, ";")
+	},
+	"PushedAt": func(repo data.RepoInfo) string {
+		if repo.PushedAt.IsZero() {
+			return ""
+		}
+		return repo.PushedAt.UTC().Format(time.RFC3339)
+	},
+}
+
+// MetadataColumns lists the optional repository metadata columns in the order
+// they are described to users.
+var MetadataColumns = []string{
+	"Visibility",
+	"Archived",
+	"Fork",
+	"DefaultBranch",
+	"RepositoryNodeID",
+	"URL",
+	"Language",
+	"Topics",
+	"PushedAt",
+}
+
+// ParseReportColumns returns the report columns named in names, in the given
+// order, or BranchRulesHeader when names is empty. Any column of
+// BranchRulesHeader or MetadataColumns may be named, regardless of case.
+func ParseReportColumns(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return append([]string{}, BranchRulesHeader...), nil
+	}
+	known := append(append([]string{}, BranchRulesHeader...), MetadataColumns...)
+	var columns []string
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		column, ok := findColumn(known, name)
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q, expected any of %s", name, strings.Join(known, ", "))
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("column %s is named more than once", column)
+		}
+		seen[column] = true
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// ReportRecord returns the values of columns for a rule, taking the rule's
+// settings from ruleRecord, as formatted by BranchProtectionRuleRecord, and
+// the metadata of its repository from repo. Topics are separated by
+// semicolons, and PushedAt is empty for repositories that were never pushed to.
+func ReportRecord(repo data.RepoInfo, ruleRecord []string, columns []string) []string {
+	index := HeaderIndex(BranchRulesHeader)
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		if value, ok := metadataColumns[column]; ok {
+			record[i] = value(repo)
+		} else {
+			record[i] = ruleRecord[index[column]]
+		}
+	}
+	return record
+}
+
+// findColumn returns the column in columns equal to name regardless of case.
+func findColumn(columns []string, name string) (string, bool) {
+	for _, column := range columns {
+		if strings.EqualFold(column, strings.TrimSpace(name)) {
+			return column, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseReportColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "default columns", want: BranchRulesHeader},
+		{
+			name:  "given order, regardless of case",
+			names: []string{"branchprotectionrulepattern", " RepositoryName ", "Topics"},
+			want:  []string{"BranchProtectionRulePattern", "RepositoryName", "Topics"},
+		},
+		{name: "unknown column", names: []string{"RepositoryName", "Colour"}, wantErr: true},
+		{name: "duplicate column", names: []string{"LockBranch", "lockbranch"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseReportColumns(tt.names)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseReportColumns() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseReportColumns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseReportColumnsCopiesHeader(t *testing.T) {
+	columns, err := ParseReportColumns(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns[0] = "Changed"
+	if BranchRulesHeader[0] != "RepositoryName" {
+		t.Errorf("BranchRulesHeader was modified through the default columns")
+	}
+}
@@ -0,0 +1,281 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/cli/go-gh/v2/pkg/jq"
+	"github.com/cli/go-gh/v2/pkg/jsonpretty"
+	"github.com/cli/go-gh/v2/pkg/tableprinter"
+	"github.com/cli/go-gh/v2/pkg/template"
+	"github.com/cli/go-gh/v2/pkg/term"
+	"github.com/itchyny/gojq"
+)
+
+// RecordWriter writes the header and then each row of a report.
+// *csv.Writer is a RecordWriter.
+type RecordWriter interface {
+	Write(record []string) error
+	Flush()
+	Error() error
+}
+
+// listColumns are the report columns holding several values separated by
+// semicolons, written as arrays in JSON.
+var listColumns = map[string]bool{
+	"Topics":      true,
+	"OwningTeams": true,
+}
+
+// ParseJSONFields returns the fields named in names, matched regardless of
+// case. Any report column may be named, as well as Organization, OwningTeams
+// and Property.<name>.
+func ParseJSONFields(names []string) ([]string, error) {
+	known := append(append([]string{}, BranchRulesHeader...), MetadataColumns...)
+	known = append(known, "Organization", "OwningTeams")
+	var fields []string
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		field, ok := findColumn(known, name)
+		if strings.HasPrefix(name, PropertyColumnPrefix) && len(name) > len(PropertyColumnPrefix) {
+			field, ok = name, true
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown JSON field %q, expected any of %s or %s<name>", name, strings.Join(known, ", "), PropertyColumnPrefix)
+		}
+		if !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// CheckJSONFormat returns an error for an invalid jq expression or Go
+// template, so that it is reported before any rules are gathered.
+func CheckJSONFormat(jqExpr string, tmpl string) error {
+	if jqExpr != "" {
+		if _, err := gojq.Parse(jqExpr); err != nil {
+			return fmt.Errorf("invalid --jq expression: %w", err)
+		}
+	}
+	if tmpl != "" {
+		if err := template.New(io.Discard, 80, false).Parse(tmpl); err != nil {
+			return fmt.Errorf("invalid --template: %w", err)
+		}
+	}
+	return nil
+}
+
+// JSONWriter collects the rows of a report and, when closed, writes them as
+// a JSON array of objects holding the selected fields. The array is filtered
+// with a jq expression or rendered with a Go template when either is set, as
+// with the --jq and --template options of gh.
+type JSONWriter struct {
+	w        io.Writer
+	fields   []string
+	jqExpr   string
+	template string
+	header   map[string]int
+	rows     []map[string]interface{}
+}
+
+func NewJSONWriter(w io.Writer, fields []string, jqExpr string, tmpl string) *JSONWriter {
+	return &JSONWriter{
+		w:        w,
+		fields:   fields,
+		jqExpr:   jqExpr,
+		template: tmpl,
+		rows:     []map[string]interface{}{},
+	}
+}
+
+// Write records the header on its first call and a row on every other.
+// Fields without a column in the header are null.
+func (j *JSONWriter) Write(record []string) error {
+	if j.header == nil {
+		j.header = HeaderIndex(record)
+		return nil
+	}
+	row := make(map[string]interface{}, len(j.fields))
+	for _, field := range j.fields {
+		i, ok := j.header[field]
+		if !ok {
+			row[field] = nil
+			continue
+		}
+		row[field] = jsonValue(field, record[i])
+	}
+	j.rows = append(j.rows, row)
+	return nil
+}
+
+// Flush does nothing, rows are only written when the JSONWriter is closed.
+func (j *JSONWriter) Flush() {}
+
+func (j *JSONWriter) Error() error {
+	return nil
+}
+
+// Close writes every row collected, pretty-printed and colored when writing
+// to a terminal.
+func (j *JSONWriter) Close() error {
+	output, err := json.Marshal(j.rows)
+	if err != nil {
+		return err
+	}
+	terminal := term.FromEnv()
+	switch {
+	case j.jqExpr != "":
+		indent := ""
+		if terminal.IsTerminalOutput() {
+			indent = "  "
+		}
+		return jq.EvaluateFormatted(bytes.NewReader(output), j.w, j.jqExpr, indent, terminal.IsColorEnabled())
+	case j.template != "":
+		width, _, err := terminal.Size()
+		if err != nil {
+			width = 80
+		}
+		t := template.New(j.w, width, terminal.IsColorEnabled())
+		if err := t.Parse(j.template); err != nil {
+			return err
+		}
+		if err := t.Execute(bytes.NewReader(output)); err != nil {
+			return err
+		}
+		return t.Flush()
+	case terminal.IsTerminalOutput():
+		return jsonpretty.Format(j.w, bytes.NewReader(output), "  ", terminal.IsColorEnabled())
+	default:
+		_, err := j.w.Write(append(output, '\n'))
+		return err
+	}
+}
+
+// BufferedCSVWriter is a csv.Writer that holds the rows written to it until
+// it is flushed, and then writes them in a single call. A checkpointed report
+// flushed after each repository so never holds only some of its rows, which a
+// resumed run would write again.
+type BufferedCSVWriter struct {
+	*csv.Writer
+	w   io.Writer
+	buf bytes.Buffer
+	err error
+}
+
+func NewBufferedCSVWriter(w io.Writer) *BufferedCSVWriter {
+	b := &BufferedCSVWriter{w: w}
+	b.Writer = csv.NewWriter(&b.buf)
+	return b
+}
+
+// Flush writes the rows held since the last call.
+func (b *BufferedCSVWriter) Flush() {
+	b.Writer.Flush()
+	if b.err == nil && b.buf.Len() > 0 {
+		_, b.err = b.w.Write(b.buf.Bytes())
+	}
+	b.buf.Reset()
+}
+
+// Error returns the first error from writing or flushing a row.
+func (b *BufferedCSVWriter) Error() error {
+	if err := b.Writer.Error(); err != nil {
+		return err
+	}
+	return b.err
+}
+
+// TableWriter collects the rows of a report and, when closed, writes them as
+// a table fitted to the width of the terminal, with booleans colored. When
+// not writing to a terminal, each row is written as it is added, as
+// tab-separated values.
+type TableWriter struct {
+	tp           tableprinter.TablePrinter
+	colorEnabled bool
+	hasHeader    bool
+}
+
+func NewTableWriter(w io.Writer, isTTY bool) *TableWriter {
+	terminal := term.FromEnv()
+	width, _, err := terminal.Size()
+	if err != nil {
+		width = 80
+	}
+	return &TableWriter{
+		tp:           tableprinter.New(w, isTTY, width),
+		colorEnabled: isTTY && terminal.IsColorEnabled(),
+	}
+}
+
+// Write adds the header on its first call and a row on every other.
+func (t *TableWriter) Write(record []string) error {
+	if !t.hasHeader {
+		t.hasHeader = true
+		t.tp.AddHeader(record)
+		return nil
+	}
+	for _, value := range record {
+		switch {
+		case t.colorEnabled && value == "true":
+			t.tp.AddField(value, tableprinter.WithColor(green))
+		case t.colorEnabled && value == "false":
+			t.tp.AddField(value, tableprinter.WithColor(red))
+		default:
+			t.tp.AddField(value)
+		}
+	}
+	t.tp.EndRow()
+	return nil
+}
+
+// Flush does nothing, tables are only written when the TableWriter is closed
+// so that their columns fit every row.
+func (t *TableWriter) Flush() {}
+
+func (t *TableWriter) Error() error {
+	return nil
+}
+
+// Close writes the table.
+func (t *TableWriter) Close() error {
+	return t.tp.Render()
+}
+
+func green(s string) string {
+	return "\x1b[32m" + s + "\x1b[0m"
+}
+
+func red(s string) string {
+	return "\x1b[31m" + s + "\x1b[0m"
+}
+
+// jsonValue converts a report value to its JSON type: booleans and integers
+// for the columns holding them, and arrays for lists.
+func jsonValue(field string, value string) interface{} {
+	switch {
+	case listColumns[field]:
+		values := []string{}
+		if value != "" {
+			values = strings.Split(value, ";")
+		}
+		return values
+	case field == "Archived" || field == "Fork" || slices.Contains(booleanColumns, field):
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case slices.Contains(integerColumns, field):
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return value
+}
@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/cli/go-gh/v2/pkg/tableprinter"
+)
+
+func TestJsonValue(t *testing.T) {
+	tests := []struct {
+		field string
+		value string
+		want  interface{}
+	}{
+		{field: "LockBranch", value: "true", want: true},
+		{field: "Archived", value: "false", want: false},
+		{field: "RequiredApprovingReviewCount", value: "2", want: 2},
+		{field: "RepositoryID", value: "not a number", want: "not a number"},
+		{field: "Topics", value: "go;cli", want: []string{"go", "cli"}},
+		{field: "OwningTeams", value: "", want: []string{}},
+		{field: "BranchProtectionRulePattern", value: "true", want: "true"},
+		{field: "Property.team", value: "platform", want: "platform"},
+	}
+
+	for _, tt := range tests {
+		if got := jsonValue(tt.field, tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("jsonValue(%q, %q) = %#v, want %#v", tt.field, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestJSONWriter(t *testing.T) {
+	t.Setenv("GH_FORCE_TTY", "")
+	header := []string{"RepositoryName", "BranchProtectionRulePattern", "LockBranch", "Topics"}
+	rows := [][]string{
+		{"repo-a", "main", "true", "go;cli"},
+		{"repo-b", "release/*", "false", ""},
+	}
+	fields := []string{"RepositoryName", "LockBranch", "Topics", "OwningTeams"}
+
+	tests := []struct {
+		name     string
+		jqExpr   string
+		template string
+		want     string
+	}{
+		{
+			name: "selected fields",
+			want: `[{"LockBranch":true,"OwningTeams":null,"RepositoryName":"repo-a","Topics":["go","cli"]},` +
+				`{"LockBranch":false,"OwningTeams":null,"RepositoryName":"repo-b","Topics":[]}]` + "\n",
+		},
+		{
+			name:   "jq expression",
+			jqExpr: `.[] | select(.LockBranch) | .RepositoryName`,
+			want:   "repo-a\n",
+		},
+		{
+			name:     "template",
+			template: `{{range .}}{{.RepositoryName}} {{len .Topics}}{{"\n"}}{{end}}`,
+			want:     "repo-a 2\nrepo-b 0\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			w := NewJSONWriter(&out, fields, tt.jqExpr, tt.template)
+			for _, record := range append([][]string{header}, rows...) {
+				if err := w.Write(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if out.Len() > 0 {
+				t.Errorf("rows were written before Close: %q", out.String())
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("Close() wrote %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONWriterWithoutRows(t *testing.T) {
+	t.Setenv("GH_FORCE_TTY", "")
+	var out bytes.Buffer
+	w := NewJSONWriter(&out, []string{"RepositoryName"}, "", "")
+	if err := w.Write([]string{"RepositoryName"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "[]\n" {
+		t.Errorf("Close() wrote %q, want an empty array", out.String())
+	}
+}
+
+func TestCheckJSONFormat(t *testing.T) {
+	tests := []struct {
+		jqExpr   string
+		template string
+		wantErr  bool
+	}{
+		{},
+		{jqExpr: ".[].RepositoryName"},
+		{template: "{{range .}}{{.RepositoryName}}{{end}}"},
+		{jqExpr: ".[", wantErr: true},
+		{template: "{{range .}}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if err := CheckJSONFormat(tt.jqExpr, tt.template); (err != nil) != tt.wantErr {
+			t.Errorf("CheckJSONFormat(%q, %q) error = %v, wantErr %v", tt.jqExpr, tt.template, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseJSONFields(t *testing.T) {
+	tests := []struct {
+		names   []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			names: []string{"repositoryname", "Topics", "organization", "Property.team", "RepositoryName"},
+			want:  []string{"RepositoryName", "Topics", "Organization", "Property.team"},
+		},
+		{names: []string{"Colour"}, wantErr: true},
+		{names: []string{"Property."}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseJSONFields(tt.names)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseJSONFields(%q) error = %v, wantErr %v", tt.names, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseJSONFields(%q) = %v, want %v", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestTableWriter(t *testing.T) {
+	records := [][]string{
+		{"RepositoryName", "LockBranch"},
+		{"repo-a", "true"},
+		{"repo-long-name", "false"},
+	}
+
+	tests := []struct {
+		name  string
+		isTTY bool
+		color bool
+		want  string
+	}{
+		{
+			name: "tab-separated without header",
+			want: "repo-a\ttrue\nrepo-long-name\tfalse\n",
+		},
+		{
+			name:  "aligned with header",
+			isTTY: true,
+			want:  "RepositoryName  LockBranch\nrepo-a          true\nrepo-long-name  false\n",
+		},
+		{
+			name:  "colored booleans",
+			isTTY: true,
+			color: true,
+			want:  "RepositoryName  LockBranch\nrepo-a          " + green("true") + "\nrepo-long-name  " + red("false") + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			w := &TableWriter{tp: tableprinter.New(&out, tt.isTTY, 80), colorEnabled: tt.color}
+			for _, record := range records {
+				if err := w.Write(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w.Flush()
+			if tt.isTTY && out.Len() > 0 {
+				t.Errorf("rows were written before Close: %q", out.String())
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("Close() wrote %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
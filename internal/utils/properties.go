@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/katiem0/gh-branch-rules/internal/data"
+)
+
+// PropertyColumnPrefix prefixes the name of each custom property written as a
+// report column.
+const PropertyColumnPrefix = "Property."
+
+// RepoProperties holds the custom property values of repositories, keyed by
+// lowercased repository name and then property name. Multi-select properties
+// hold several values. Repositories are looked up regardless of case.
+type RepoProperties map[string]map[string][]string
+
+func NewRepoProperties(allValues []data.RepoPropertyValues) RepoProperties {
+	properties := make(RepoProperties, len(allValues))
+	for _, repoValues := range allValues {
+		values := make(map[string][]string, len(repoValues.Properties))
+		for _, property := range repoValues.Properties {
+			switch value := property.Value.(type) {
+			case string:
+				values[property.PropertyName] = []string{value}
+			case []interface{}:
+				for _, item := range value {
+					values[property.PropertyName] = append(values[property.PropertyName], fmt.Sprint(item))
+				}
+			}
+		}
+		properties[strings.ToLower(repoValues.RepositoryName)] = values
+	}
+	return properties
+}
+
+// Names returns the name of every property set on any repository, sorted.
+func (p RepoProperties) Names() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, values := range p {
+		for name := range values {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Match reports whether the repository has every property in filters set to
+// the given value, or including it for multi-select properties.
+func (p RepoProperties) Match(repo string, filters map[string]string) bool {
+	for name, want := range filters {
+		found := false
+		for _, value := range p[strings.ToLower(repo)][name] {
+			if strings.EqualFold(value, want) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Record returns the repository's values of the named properties as report
+// fields, joining the values of multi-select properties with semicolons.
+func (p RepoProperties) Record(repo string, names []string) []string {
+	record := make([]string, len(names))
+	for i, name := range names {
+		record[i] = strings.Join(p[strings.ToLower(repo)][name], ";")
+	}
+	return record
+}
+
+// ParsePropertyFilters parses --property values of the form key=value.
+func ParsePropertyFilters(args []string) (map[string]string, error) {
+	filters := make(map[string]string, len(args))
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("--property must be of the form key=value, got %q", arg)
+		}
+		filters[name] = value
+	}
+	return filters, nil
+}
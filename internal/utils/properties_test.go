@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/katiem0/gh-branch-rules/internal/data"
+)
+
+// testProperties returns properties decoded from the JSON of the REST API.
+func testProperties(t *testing.T) RepoProperties {
+	t.Helper()
+	var allValues []data.RepoPropertyValues
+	err := json.Unmarshal([]byte(`[
+		{"repository_id": 1, "repository_name": "payments-api", "properties": [
+			{"property_name": "team", "value": "Platform"},
+			{"property_name": "regions", "value": ["eu", "us"]},
+			{"property_name": "unset", "value": null}
+		]},
+		{"repository_id": 2, "repository_name": "Website", "properties": [
+			{"property_name": "team", "value": "web"}
+		]}
+	]`), &allValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewRepoProperties(allValues)
+}
+
+func TestNewRepoProperties(t *testing.T) {
+	properties := testProperties(t)
+	want := RepoProperties{
+		"payments-api": {"team": {"Platform"}, "regions": {"eu", "us"}},
+		"website":      {"team": {"web"}},
+	}
+	if !reflect.DeepEqual(properties, want) {
+		t.Errorf("NewRepoProperties() = %v, want %v", properties, want)
+	}
+	if names := properties.Names(); !reflect.DeepEqual(names, []string{"regions", "team"}) {
+		t.Errorf("Names() = %v", names)
+	}
+	if record := properties.Record("payments-api", []string{"team", "regions", "unset"}); !reflect.DeepEqual(record, []string{"Platform", "eu;us", ""}) {
+		t.Errorf("Record() = %v", record)
+	}
+}
+
+func TestRepoPropertiesMatch(t *testing.T) {
+	properties := testProperties(t)
+
+	tests := []struct {
+		name    string
+		repo    string
+		filters map[string]string
+		want    bool
+	}{
+		{name: "no filters", repo: "website", want: true},
+		{name: "repository regardless of case", repo: "Payments-API", filters: map[string]string{"team": "Platform"}, want: true},
+		{name: "value regardless of case", repo: "payments-api", filters: map[string]string{"team": "platform"}, want: true},
+		{name: "other value", repo: "website", filters: map[string]string{"team": "platform"}},
+		{name: "one of several values", repo: "payments-api", filters: map[string]string{"regions": "us"}, want: true},
+		{name: "every filter", repo: "payments-api", filters: map[string]string{"team": "Platform", "regions": "apac"}},
+		{name: "property not set", repo: "website", filters: map[string]string{"regions": "eu"}},
+		{name: "unknown repository", repo: "other", filters: map[string]string{"team": "web"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := properties.Match(tt.repo, tt.filters); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePropertyFilters(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{args: nil, want: map[string]string{}},
+		{args: []string{"team=platform", "tier=1=gold"}, want: map[string]string{"team": "platform", "tier": "1=gold"}},
+		{args: []string{"team="}, want: map[string]string{"team": ""}},
+		{args: []string{"team"}, wantErr: true},
+		{args: []string{"=platform"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePropertyFilters(tt.args)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePropertyFilters(%q) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParsePropertyFilters(%q) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
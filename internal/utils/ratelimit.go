@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/katiem0/gh-branch-rules/internal/data"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxRateLimitWaits bounds how many times a single request waits out a
+	// rate limit before its response is returned to the caller.
+	maxRateLimitWaits = 5
+	// secondaryRateLimitWait is used when GitHub reports a secondary rate
+	// limit without saying how long to wait.
+	secondaryRateLimitWait = time.Minute
+)
+
+// RateLimiter pauses API requests while GitHub's primary rate limit is
+// depleted and waits out secondary rate limits before retrying. A single
+// RateLimiter is safe for concurrent use and can be shared by clients.
+type RateLimiter struct {
+	mu       sync.Mutex
+	resumeAt map[string]time.Time
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		resumeAt: make(map[string]time.Time),
+	}
+}
+
+// RoundTripper wraps rt so that requests wait for the rate limit of their
+// resource to reset, and requests rejected by a rate limit are sent again
+// once it has passed. Rejected requests were never applied, so mutations are
+// safe to send again.
+func (l *RateLimiter) RoundTripper(rt http.RoundTripper) http.RoundTripper {
+	return &rateLimitRoundTripper{limiter: l, rt: rt}
+}
+
+// Observe records the rateLimit returned with a GraphQL query, pausing
+// further GraphQL requests if the next query is likely to exceed it.
+func (l *RateLimiter) Observe(rateLimit data.RateLimit) {
+	zap.S().Debugf("GraphQL rate limit: %d remaining, query cost %d, resets at %s", rateLimit.Remaining, rateLimit.Cost, rateLimit.ResetAt)
+	if rateLimit.ResetAt.IsZero() {
+		return
+	}
+	if rateLimit.Remaining < max(rateLimit.Cost, 1) {
+		l.pauseUntil("graphql", rateLimit.ResetAt)
+	}
+}
+
+func (l *RateLimiter) pauseUntil(resource string, resumeAt time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if resumeAt.After(l.resumeAt[resource]) {
+		l.resumeAt[resource] = resumeAt
+	}
+}
+
+func (l *RateLimiter) wait(resource string) {
+	l.mu.Lock()
+	resumeAt := l.resumeAt[resource]
+	l.mu.Unlock()
+
+	if wait := time.Until(resumeAt); wait > 0 {
+		zap.S().Warnf("Rate limit for %s API depleted, waiting %s until %s", resource, wait.Round(time.Second), resumeAt.Format(time.RFC3339))
+		time.Sleep(wait)
+	}
+}
+
+type rateLimitRoundTripper struct {
+	limiter *RateLimiter
+	rt      http.RoundTripper
+}
+
+func (t *rateLimitRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resource := "core"
+	if strings.HasSuffix(req.URL.Path, "/graphql") {
+		resource = "graphql"
+	}
+
+	for attempt := 0; ; attempt++ {
+		t.limiter.wait(resource)
+
+		resp, err := t.rt.RoundTrip(req)
+		if err != nil {
+			return resp, err
+		}
+		if r := resp.Header.Get("X-RateLimit-Resource"); r != "" {
+			resource = r
+		}
+
+		resumeAt, limited := rateLimitResumeAt(resp)
+		if !resumeAt.IsZero() {
+			t.limiter.pauseUntil(resource, resumeAt)
+		}
+		if !limited || attempt >= maxRateLimitWaits {
+			return resp, nil
+		}
+
+		// The request was rejected, so rewind its body and send it again
+		if req.Body != nil {
+			if req.GetBody == nil {
+				return resp, nil
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return resp, nil
+			}
+			req.Body = body
+		}
+		zap.S().Warnf("Request to %s was rate limited (HTTP %d)", req.URL.Path, resp.StatusCode)
+		resp.Body.Close()
+	}
+}
+
+// rateLimitResumeAt reads the rate limit headers of a response, returning
+// when requests may resume if the limit is depleted, and whether the request
+// itself was rejected by a primary or secondary rate limit.
+func rateLimitResumeAt(resp *http.Response) (time.Time, bool) {
+	var resumeAt time.Time
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			resumeAt = time.Unix(reset, 0)
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			return time.Now().Add(time.Duration(seconds) * time.Second), true
+		}
+		if !resumeAt.IsZero() {
+			return resumeAt, true
+		}
+		if resp.StatusCode == http.StatusTooManyRequests || isSecondaryRateLimit(resp) {
+			return time.Now().Add(secondaryRateLimitWait), true
+		}
+	case http.StatusOK:
+		// GraphQL reports an exhausted primary rate limit as an error in a
+		// successful response
+		if !resumeAt.IsZero() && hasRateLimitedError(resp) {
+			return resumeAt, true
+		}
+	}
+	return resumeAt, false
+}
+
+func isSecondaryRateLimit(resp *http.Response) bool {
+	return bodyContains(resp, []byte("secondary rate limit"))
+}
+
+func hasRateLimitedError(resp *http.Response) bool {
+	return bodyContains(resp, []byte(`"RATE_LIMITED"`))
+}
+
+// bodyContains reports whether the response body contains s, leaving the
+// body readable by the caller.
+func bodyContains(resp *http.Response, s []byte) bool {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return err == nil && bytes.Contains(body, s)
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimitResumeAt(t *testing.T) {
+	reset := time.Unix(1767225600, 0)
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		statusCode  int
+		header      map[string]string
+		body        string
+		wantResume  time.Time
+		wantWait    time.Duration
+		wantLimited bool
+	}{
+		{
+			name:       "remaining requests",
+			statusCode: http.StatusOK,
+			header:     map[string]string{"X-RateLimit-Remaining": "10", "X-RateLimit-Reset": "1767225600"},
+		},
+		{
+			name:       "last request",
+			statusCode: http.StatusOK,
+			header:     map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1767225600"},
+			wantResume: reset,
+		},
+		{
+			name:        "primary rate limit",
+			statusCode:  http.StatusForbidden,
+			header:      map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1767225600"},
+			wantResume:  reset,
+			wantLimited: true,
+		},
+		{
+			name:        "GraphQL primary rate limit",
+			statusCode:  http.StatusOK,
+			header:      map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1767225600"},
+			body:        `{"errors":[{"type":"RATE_LIMITED","message":"API rate limit exceeded"}]}`,
+			wantResume:  reset,
+			wantLimited: true,
+		},
+		{
+			name:        "retry after",
+			statusCode:  http.StatusTooManyRequests,
+			header:      map[string]string{"Retry-After": "30"},
+			wantWait:    30 * time.Second,
+			wantLimited: true,
+		},
+		{
+			name:        "secondary rate limit",
+			statusCode:  http.StatusForbidden,
+			body:        `{"message":"You have exceeded a secondary rate limit."}`,
+			wantWait:    secondaryRateLimitWait,
+			wantLimited: true,
+		},
+		{
+			name:       "forbidden",
+			statusCode: http.StatusForbidden,
+			body:       `{"message":"Resource not accessible by integration"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: tt.statusCode,
+				Header:     make(http.Header),
+				Body:       io.NopCloser(strings.NewReader(tt.body)),
+			}
+			for name, value := range tt.header {
+				resp.Header.Set(name, value)
+			}
+
+			resumeAt, limited := rateLimitResumeAt(resp)
+			if limited != tt.wantLimited {
+				t.Errorf("rateLimitResumeAt() limited = %v, want %v", limited, tt.wantLimited)
+			}
+			switch {
+			case tt.wantWait > 0:
+				if wait := resumeAt.Sub(now); wait < tt.wantWait || wait > tt.wantWait+time.Minute {
+					t.Errorf("rateLimitResumeAt() waits %s, want %s", wait, tt.wantWait)
+				}
+			case !resumeAt.Equal(tt.wantResume):
+				t.Errorf("rateLimitResumeAt() resumes at %s, want %s", resumeAt, tt.wantResume)
+			}
+
+			// The body is left for the caller to read
+			if body, _ := io.ReadAll(resp.Body); string(body) != tt.body {
+				t.Errorf("response body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
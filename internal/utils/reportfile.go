@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ReportFile is a report being written to a file. Unless it is written in
+// place, it is written to a temporary file next to the report, which only
+// replaces the report when committed, so that readers never see a partly
+// written report.
+type ReportFile struct {
+	*os.File
+	name    string
+	inPlace bool
+	// start is the size of the file before any rows were written to it
+	start int64
+}
+
+// OpenReportFile opens fileName to write a report to, adding to the existing
+// report when appendTo is set and replacing it otherwise. Reports written in
+// place, such as those resumed from a checkpoint, hold every row written if
+// the run is interrupted.
+func OpenReportFile(fileName string, appendTo bool, inPlace bool) (*ReportFile, error) {
+	if inPlace {
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if appendTo {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		f, err := os.OpenFile(fileName, flags, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return &ReportFile{File: f, name: fileName, inPlace: true}, nil
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(fileName), "."+filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	report := &ReportFile{File: f, name: fileName}
+	if err := f.Chmod(0644); err != nil {
+		report.Discard()
+		return nil, err
+	}
+	if appendTo {
+		if err := copyFile(f, fileName); err != nil {
+			report.Discard()
+			return nil, err
+		}
+		if report.start, err = f.Seek(0, io.SeekCurrent); err != nil {
+			report.Discard()
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// Commit closes the report, replacing the previous report with it.
+func (f *ReportFile) Commit() error {
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if f.inPlace {
+		return nil
+	}
+	return os.Rename(f.File.Name(), f.name)
+}
+
+// Discard closes the report, leaving the previous report as it was. Reports
+// written in place keep the rows written so far.
+func (f *ReportFile) Discard() error {
+	err := f.Close()
+	if f.inPlace {
+		return err
+	}
+	return os.Remove(f.File.Name())
+}
+
+// KeepPartial closes a report that could not be completed, leaving the
+// previous report as it was and keeping the rows written so far in a file
+// named after it with a .partial extension, whose name is returned. Nothing
+// is kept if no rows were written, and reports written in place already hold
+// every row written, so no name is returned for either.
+func (f *ReportFile) KeepPartial() (string, error) {
+	if f.inPlace {
+		return "", f.Close()
+	}
+	info, err := f.Stat()
+	if err != nil || info.Size() == f.start {
+		f.Discard() // nolint:errcheck
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	partial := f.name + ".partial"
+	return partial, os.Rename(f.File.Name(), partial)
+}
+
+// ReadReportHeader returns the header of the report in fileName, or nil if
+// the file does not exist or is empty.
+func ReadReportHeader(fileName string) ([]string, error) {
+	f, err := os.Open(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header, err := csv.NewReader(f).Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	return header, err
+}
+
+// copyFile copies the contents of fileName, if it exists, to w.
+func copyFile(w io.Writer, fileName string) error {
+	f, err := os.Open(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// readFile returns the contents of fileName, or "missing" if it does not
+// exist.
+func readFile(t *testing.T, fileName string) string {
+	t.Helper()
+	content, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return "missing"
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestReportFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		existing    string
+		appendTo    bool
+		inPlace     bool
+		rows        string
+		finish      func(f *ReportFile) (string, error)
+		want        string
+		wantPartial string
+	}{
+		{
+			name:        "commit replaces the report",
+			rows:        "new\n",
+			finish:      func(f *ReportFile) (string, error) { return "", f.Commit() },
+			want:        "new\n",
+			wantPartial: "missing",
+		},
+		{
+			name:        "commit appends to the report",
+			existing:    "old\n",
+			appendTo:    true,
+			rows:        "new\n",
+			finish:      func(f *ReportFile) (string, error) { return "", f.Commit() },
+			want:        "old\nnew\n",
+			wantPartial: "missing",
+		},
+		{
+			name:        "discard leaves the report",
+			existing:    "old\n",
+			rows:        "new\n",
+			finish:      func(f *ReportFile) (string, error) { return "", f.Discard() },
+			want:        "old\n",
+			wantPartial: "missing",
+		},
+		{
+			name:        "partial rows are kept beside the report",
+			existing:    "old\n",
+			appendTo:    true,
+			rows:        "new\n",
+			finish:      func(f *ReportFile) (string, error) { return f.KeepPartial() },
+			want:        "old\n",
+			wantPartial: "old\nnew\n",
+		},
+		{
+			name:        "nothing is kept without rows",
+			existing:    "old\n",
+			appendTo:    true,
+			finish:      func(f *ReportFile) (string, error) { return f.KeepPartial() },
+			want:        "old\n",
+			wantPartial: "missing",
+		},
+		{
+			name:        "in place rows stay in the report",
+			existing:    "old\n",
+			appendTo:    true,
+			inPlace:     true,
+			rows:        "new\n",
+			finish:      func(f *ReportFile) (string, error) { return f.KeepPartial() },
+			want:        "old\nnew\n",
+			wantPartial: "missing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fileName := filepath.Join(dir, "report.csv")
+			if tt.existing != "" {
+				if err := os.WriteFile(fileName, []byte(tt.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			f, err := OpenReportFile(fileName, tt.appendTo, tt.inPlace)
+			if err != nil {
+				t.Fatalf("OpenReportFile() error = %v", err)
+			}
+			if _, err := f.WriteString(tt.rows); err != nil {
+				t.Fatal(err)
+			}
+			// Readers see the previous report until the new one is committed
+			if !tt.inPlace && tt.existing != "" && readFile(t, fileName) != tt.existing {
+				t.Errorf("report changed before it was committed")
+			}
+
+			partial, err := tt.finish(f)
+			if err != nil {
+				t.Fatalf("finishing the report: %v", err)
+			}
+			if got := readFile(t, fileName); got != tt.want {
+				t.Errorf("report = %q, want %q", got, tt.want)
+			}
+			if got := readFile(t, fileName+".partial"); got != tt.wantPartial {
+				t.Errorf("partial report = %q, want %q", got, tt.wantPartial)
+			}
+			if tt.wantPartial != "missing" && partial != fileName+".partial" {
+				t.Errorf("KeepPartial() = %q, want %q", partial, fileName+".partial")
+			}
+
+			// No temporary files are left behind
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				if name := entry.Name(); name != "report.csv" && name != "report.csv.partial" {
+					t.Errorf("temporary file %s was left behind", name)
+				}
+			}
+		})
+	}
+}
+
+func TestReadReportHeader(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{name: "missing"},
+		{name: "empty", content: ""},
+		{name: "report", content: "RepositoryName,BranchProtectionRulePattern\nrepo-a,main\n", want: []string{"RepositoryName", "BranchProtectionRulePattern"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(dir, tt.name+".csv")
+			if tt.name != "missing" {
+				if err := os.WriteFile(fileName, []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := ReadReportHeader(fileName)
+			if err != nil {
+				t.Fatalf("ReadReportHeader() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadReportHeader() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
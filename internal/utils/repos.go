@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ReadReposFile reads repository names from fileName, or from stdin if it is
+// "-". Each line holds a repo or owner/repo, and repositories are returned as
+// owner/repo with defaultOwner used for lines without one. Blank lines and
+// lines starting with # are skipped, as are repositories already read.
+func ReadReposFile(fileName string, defaultOwner string) ([]string, error) {
+	var repos []string
+	seen := make(map[string]bool)
+	err := scanListFile(fileName, "repositories", func(name string, line int, text string) error {
+		owner, repo, ok := strings.Cut(text, "/")
+		if !ok {
+			owner, repo = defaultOwner, text
+		}
+		if owner == "" || repo == "" || strings.Contains(repo, "/") {
+			return fmt.Errorf("%s line %d: %q is not a repo or owner/repo", name, line, text)
+		}
+		fullName := owner + "/" + repo
+		if !seen[strings.ToLower(fullName)] {
+			seen[strings.ToLower(fullName)] = true
+			repos = append(repos, fullName)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repos, nil
+}
+
+// ReadOrgsFile reads one organization per line from fileName, or from stdin
+// if it is "-". Blank lines and lines starting with # are skipped, as are
+// organizations already read.
+func ReadOrgsFile(fileName string) ([]string, error) {
+	var orgs []string
+	seen := make(map[string]bool)
+	err := scanListFile(fileName, "organizations", func(name string, line int, text string) error {
+		if strings.ContainsAny(text, "/ \t") {
+			return fmt.Errorf("%s line %d: %q is not an organization", name, line, text)
+		}
+		if !seen[strings.ToLower(text)] {
+			seen[strings.ToLower(text)] = true
+			orgs = append(orgs, text)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orgs, nil
+}
+
+// scanListFile calls fn with each line of fileName, or stdin if it is "-",
+// trimmed of whitespace and skipping blank lines and # comments. name is
+// how the file is referred to in errors. It is an error for the file to
+// hold no lines, reported as having no items.
+func scanListFile(fileName string, items string, fn func(name string, line int, text string) error) error {
+	var r io.Reader = os.Stdin
+	name := "stdin"
+	if fileName != "-" {
+		f, err := os.Open(fileName)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+		name = fileName
+	}
+
+	found := false
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		found = true
+		if err := fn(name, line, text); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no %s found in %s", items, name)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeListFile writes content to a file in a temporary directory and
+// returns its name.
+func writeListFile(t *testing.T, content string) string {
+	t.Helper()
+	fileName := filepath.Join(t.TempDir(), "list.txt")
+	if err := os.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func TestReadReposFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "repos and owner/repos",
+			content: "repo-a\n  other-org/repo-b  \n",
+			want:    []string{"my-org/repo-a", "other-org/repo-b"},
+		},
+		{
+			name:    "blank lines, comments and duplicates",
+			content: "# repositories\n\nrepo-a\nREPO-A\nmy-org/repo-a\n",
+			want:    []string{"my-org/repo-a"},
+		},
+		{name: "nested path", content: "my-org/repo-a/extra\n", wantErr: true},
+		{name: "missing repo", content: "my-org/\n", wantErr: true},
+		{name: "only comments", content: "# nothing yet\n\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadReposFile(writeListFile(t, tt.content), "my-org")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadReposFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadReposFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadReposFileMissing(t *testing.T) {
+	if _, err := ReadReposFile(filepath.Join(t.TempDir(), "missing.txt"), "my-org"); err == nil {
+		t.Errorf("ReadReposFile() of a missing file returned no error")
+	}
+}
+
+func TestReadOrgsFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "organizations",
+			content: "org-a\n# archived\n\n  org-b\nOrg-A\n",
+			want:    []string{"org-a", "org-b"},
+		},
+		{name: "repository", content: "org-a/repo\n", wantErr: true},
+		{name: "several per line", content: "org-a org-b\n", wantErr: true},
+		{name: "empty", content: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadOrgsFile(writeListFile(t, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadOrgsFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadOrgsFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+)
+
+const (
+	UpdateApplied   = "applied"
+	UpdateUnchanged = "unchanged"
+	UpdateSkipped   = "skipped"
+	UpdateFailed    = "failed"
+)
+
+// UpdateResult records the outcome of updating the rule on one row of a
+// branch protection rules file.
+type UpdateResult struct {
+	Row            int
+	RepositoryName string
+	Pattern        string
+	ID             string
+	Status         string
+	Reason         string
+}
+
+// WriteUpdateResults writes one CSV line per update result to fileName.
+func WriteUpdateResults(fileName string, results []UpdateResult) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	csvWriter := csv.NewWriter(f)
+	err = csvWriter.Write([]string{
+		"Row",
+		"RepositoryName",
+		"BranchProtectionRulePattern",
+		"BranchProtectionRuleId",
+		"Status",
+		"Reason",
+	})
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		err = csvWriter.Write([]string{
+			strconv.Itoa(result.Row),
+			result.RepositoryName,
+			result.Pattern,
+			result.ID,
+			result.Status,
+			result.Reason,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/cli/go-gh/v2/pkg/api"
+	"go.uber.org/zap"
+)
+
+const (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = 30 * time.Second
+)
+
+// withRetry calls fn until it succeeds, returns an error that retryable
+// rejects, or has been retried maxRetries times. Attempts are spaced with
+// exponential backoff and jitter.
+func (g *APIGetter) withRetry(operation string, retryable func(error) bool, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= g.maxRetries || !retryable(err) {
+			return err
+		}
+
+		delay := retryDelay(attempt)
+		zap.S().Warnf("Retrying %s in %s after transient error: %v", operation, delay.Round(time.Millisecond), err)
+		time.Sleep(delay)
+	}
+}
+
+// retryDelay doubles the delay with each attempt up to retryMaxDelay, and
+// picks a random point in its upper half so that concurrent callers spread out.
+func retryDelay(attempt int) time.Duration {
+	delay := retryMaxDelay
+	if attempt < 5 {
+		delay = min(retryBaseDelay<<attempt, retryMaxDelay)
+	}
+	return delay/2 + rand.N(delay/2)
+}
+
+// isTransientError reports whether a failed query is worth sending again:
+// server errors, timeouts and dropped connections.
+func isTransientError(err error) bool {
+	var httpErr *api.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+	statusCode, ok := graphQLStatusCode(err)
+	return ok && statusCode >= 500
+}
+
+// isUnsentError reports whether a failed mutation never reached GitHub, so
+// that sending it again cannot apply it twice.
+func isUnsentError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
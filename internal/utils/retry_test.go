@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/cli/go-gh/v2/pkg/api"
+)
+
+func TestRetryClassification(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	readErr := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	timeoutErr := &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}
+
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+		unsent    bool
+	}{
+		{name: "server error", err: &api.HTTPError{StatusCode: 502}, transient: true},
+		{name: "client error", err: &api.HTTPError{StatusCode: 404}},
+		{name: "rate limited", err: &api.HTTPError{StatusCode: 403}},
+		{name: "GraphQL server error", err: errors.New("non-200 OK status code: 503 Service Unavailable body: \"\""), transient: true},
+		{name: "GraphQL client error", err: errors.New("non-200 OK status code: 401 Unauthorized body: \"\"")},
+		{name: "GraphQL error", err: &api.GraphQLError{Errors: []api.GraphQLErrorItem{{Type: "NOT_FOUND", Message: "Could not resolve"}}}},
+		{name: "refused connection", err: dialErr, transient: true, unsent: true},
+		{name: "unknown host", err: &net.DNSError{Err: "no such host", Name: "api.github.com"}, unsent: true},
+		{name: "reset connection", err: readErr, transient: true},
+		{name: "timeout", err: timeoutErr, transient: true},
+		{name: "truncated response", err: fmt.Errorf("reading response: %w", io.ErrUnexpectedEOF), transient: true},
+		{name: "other error", err: errors.New("invalid input")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientError(tt.err); got != tt.transient {
+				t.Errorf("isTransientError(%v) = %v, want %v", tt.err, got, tt.transient)
+			}
+			if got := isUnsentError(tt.err); got != tt.unsent {
+				t.Errorf("isUnsentError(%v) = %v, want %v", tt.err, got, tt.unsent)
+			}
+		})
+	}
+}
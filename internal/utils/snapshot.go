@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/katiem0/gh-branch-rules/internal/data"
+)
+
+// SnapshotRestore marks a rule whose recorded settings are restored on
+// rollback. Update only modifies existing rules, so it is the only action.
+const SnapshotRestore = "restore"
+
+// SnapshotEntry is the state of a rule captured before it was modified.
+type SnapshotEntry struct {
+	Repository data.RepoInfo
+	Rule       data.BranchProtectionRule
+	Action     string
+}
+
+// WriteSnapshot writes entries to fileName in the report layout, with a
+// trailing SnapshotAction column.
+func WriteSnapshot(fileName string, entries []SnapshotEntry) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	csvWriter := csv.NewWriter(f)
+	err = csvWriter.Write(append(append([]string{}, BranchRulesHeader...), "SnapshotAction"))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		err = csvWriter.Write(append(BranchProtectionRuleRecord(entry.Repository, entry.Rule), entry.Action))
+		if err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// ReadSnapshot reads the entries of a snapshot written by WriteSnapshot.
+func ReadSnapshot(fileName string) ([]SnapshotEntry, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	snapshotData, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshotData) == 0 {
+		return nil, fmt.Errorf("%s is empty", fileName)
+	}
+
+	col := HeaderIndex(snapshotData[0])
+	for _, name := range append(append([]string{}, BranchRulesHeader...), "SnapshotAction") {
+		if _, ok := col[name]; !ok && !optionalColumns[name] {
+			return nil, fmt.Errorf("%s is not a snapshot, missing column %s", fileName, name)
+		}
+	}
+
+	var entries []SnapshotEntry
+	for i, rule := range CreateBranchProtectionPolicyData(snapshotData) {
+		each := snapshotData[i+1]
+		entry := SnapshotEntry{
+			Repository: data.RepoInfo{Name: each[col["RepositoryName"]]},
+			Rule:       rule,
+			Action:     each[col["SnapshotAction"]],
+		}
+		if entry.Action != SnapshotRestore {
+			return nil, fmt.Errorf("%s row %d: unknown SnapshotAction %q", fileName, i+2, entry.Action)
+		}
+		entry.Repository.DatabaseId, _ = strconv.Atoi(each[col["RepositoryID"]])
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/katiem0/gh-branch-rules/internal/data"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "snapshot.csv")
+	entries := []SnapshotEntry{
+		{
+			Repository: data.RepoInfo{Name: "repo-a", DatabaseId: 101},
+			Rule: data.BranchProtectionRule{
+				ID:                           "BPR_1",
+				Pattern:                      "main",
+				RequiresApprovingReviews:     true,
+				RequiredApprovingReviewCount: 2,
+				LockBranch:                   true,
+			},
+			Action: SnapshotRestore,
+		},
+		{
+			Repository: data.RepoInfo{Name: "repo-b", DatabaseId: 102},
+			Rule:       data.BranchProtectionRule{ID: "BPR_2", Pattern: "release/*", AllowsDeletions: true},
+			Action:     SnapshotRestore,
+		},
+	}
+
+	if err := WriteSnapshot(fileName, entries); err != nil {
+		t.Fatalf("WriteSnapshot() error = %v", err)
+	}
+	got, err := ReadSnapshot(fileName)
+	if err != nil {
+		t.Fatalf("ReadSnapshot() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Errorf("ReadSnapshot() = %+v, want %+v", got, entries)
+	}
+}
+
+func TestReadSnapshotErrors(t *testing.T) {
+	header := strings.Join(append(append([]string{}, BranchRulesHeader...), "SnapshotAction"), ",")
+	row := strings.Join(ruleRow("repo-a", "main", "BPR_1"), ",")
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "empty file", content: "", wantErr: "is empty"},
+		{name: "report without action", content: strings.Join(BranchRulesHeader, ",") + "\n", wantErr: "missing column SnapshotAction"},
+		{name: "unknown action", content: header + "\n" + row + ",delete\n", wantErr: `unknown SnapshotAction "delete"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "snapshot.csv")
+			if err := os.WriteFile(fileName, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ReadSnapshot(fileName)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ReadSnapshot() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
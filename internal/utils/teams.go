@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/katiem0/gh-branch-rules/internal/data"
+)
+
+// teamPermissions orders repository permissions from least to most access.
+var teamPermissions = []string{"READ", "TRIAGE", "WRITE", "MAINTAIN", "ADMIN"}
+
+// ParseTeamPermission returns the repository permission named by a flag,
+// accepting the pull and push aliases used by the REST API.
+func ParseTeamPermission(name string) (string, error) {
+	switch permission := strings.ToUpper(name); permission {
+	case "PULL":
+		return "READ", nil
+	case "PUSH":
+		return "WRITE", nil
+	default:
+		for _, known := range teamPermissions {
+			if permission == known {
+				return permission, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unknown permission %q, must be one of read, triage, write, maintain or admin", name)
+}
+
+// PermissionAtLeast reports whether permission grants at least the access of
+// minimum. An empty minimum is met by every permission.
+func PermissionAtLeast(permission string, minimum string) bool {
+	if minimum == "" {
+		return true
+	}
+	rank := func(p string) int {
+		for i, known := range teamPermissions {
+			if p == known {
+				return i
+			}
+		}
+		return -1
+	}
+	return rank(permission) >= rank(minimum)
+}
+
+// GetAllTeamRepos returns every repository on which a team has at least the
+// minimum permission.
+func (g *APIGetter) GetAllTeamRepos(owner string, slug string, minimum string) ([]data.RepoInfo, error) {
+	var repos []data.RepoInfo
+	var endCursor *string
+	for {
+		teamQuery, err := g.GetTeamRepos(owner, slug, endCursor)
+		if err != nil {
+			return nil, err
+		}
+		team := teamQuery.Organization.Team
+		for _, edge := range team.Repositories.Edges {
+			if PermissionAtLeast(edge.Permission, minimum) {
+				repos = append(repos, edge.Node)
+			}
+		}
+		if !team.Repositories.PageInfo.HasNextPage {
+			return repos, nil
+		}
+		endCursor = &team.Repositories.PageInfo.EndCursor
+	}
+}
+
+// GetOwningTeams returns the slugs of the teams with admin permission on each
+// repository in an organization, keyed by repository name.
+func (g *APIGetter) GetOwningTeams(owner string) (map[string][]string, error) {
+	owningTeams := make(map[string][]string)
+	addEdge := func(slug string, permission string, repo string) {
+		if permission == "ADMIN" {
+			owningTeams[repo] = append(owningTeams[repo], slug)
+		}
+	}
+
+	var endCursor *string
+	for {
+		teamsQuery, err := g.GetTeams(owner, endCursor)
+		if err != nil {
+			return nil, err
+		}
+		teams := teamsQuery.Organization.Teams
+		for _, team := range teams.Nodes {
+			for _, edge := range team.Repositories.Edges {
+				addEdge(team.Slug, edge.Permission, edge.Node.Name)
+			}
+
+			// Teams with access to more than one page of repositories are
+			// queried separately for the remainder
+			reposCursor := &team.Repositories.PageInfo.EndCursor
+			for hasNextPage := team.Repositories.PageInfo.HasNextPage; hasNextPage; {
+				teamQuery, err := g.GetTeamRepos(owner, team.Slug, reposCursor)
+				if err != nil {
+					return nil, err
+				}
+				repos := teamQuery.Organization.Team.Repositories
+				for _, edge := range repos.Edges {
+					addEdge(team.Slug, edge.Permission, edge.Node.Name)
+				}
+				reposCursor = &repos.PageInfo.EndCursor
+				hasNextPage = repos.PageInfo.HasNextPage
+			}
+		}
+		if !teams.PageInfo.HasNextPage {
+			break
+		}
+		endCursor = &teams.PageInfo.EndCursor
+	}
+
+	for _, slugs := range owningTeams {
+		sort.Strings(slugs)
+	}
+	return owningTeams, nil
+}
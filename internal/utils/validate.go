@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// requiredColumns must be present and non-empty on every row. Any other
+// column may be left out of a file.
+var requiredColumns = []string{
+	"BranchProtectionRuleId",
+}
+
+// nonEmptyColumns must be non-empty on every row when they are present.
+var nonEmptyColumns = []string{
+	"RepositoryName",
+	"BranchProtectionRulePattern",
+}
+
+// optionalColumns may be left out of a snapshot, such as those written by
+// older versions of update.
+var optionalColumns = map[string]bool{
+	"Fingerprint": true,
+}
+
+// informationalColumns may be written by list alongside the settings of each
+// rule, and are ignored by update, as are the repository metadata columns.
+var informationalColumns = map[string]bool{
+	"Organization": true,
+	"OwningTeams":  true,
+}
+
+var booleanColumns = []string{
+	"AllowsDeletions",
+	"AllowsForcePushes",
+	"BlockCreations",
+	"DismissesStaleReviews",
+	"IsAdminEnforced",
+	"LockAllowsFetchAndMerge",
+	"LockBranch",
+	"RequireLastPushApproval",
+	"RequiresApprovingReviews",
+	"RequiresCodeOwnerReviews",
+	"RequiresCommitSignatures",
+	"RequiresConversationResolution",
+	"RequiresDeployments",
+	"RequiresLinearHistory",
+	"RequiresStatusChecks",
+	"RequiresStrictStatusChecks",
+	"RestrictsPushes",
+	"RestrictsReviewDismissals",
+}
+
+// booleanValues are the accepted spellings of boolean values, including the
+// capitalized forms written by spreadsheets.
+var booleanValues = map[string]bool{
+	"true":  true,
+	"True":  true,
+	"TRUE":  true,
+	"false": true,
+	"False": true,
+	"FALSE": true,
+}
+
+var integerColumns = []string{
+	"RepositoryID",
+	"RequiredApprovingReviewCount",
+}
+
+// ValidationError describes a problem found in a branch protection rules file.
+// Row is the 1-based line of the record in the file; Column is empty for
+// problems that apply to the whole row or file.
+type ValidationError struct {
+	Row     int
+	Column  string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	switch {
+	case e.Row == 0:
+		return e.Message
+	case e.Column == "":
+		return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+	default:
+		return fmt.Sprintf("row %d, column %s: %s", e.Row, e.Column, e.Message)
+	}
+}
+
+// HeaderIndex maps each column name in a header row to its position.
+func HeaderIndex(header []string) map[string]int {
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.TrimSpace(name)] = i
+	}
+	return index
+}
+
+// ValidateBranchProtectionPolicyData checks the records read from a branch
+// protection rules file, header included, and returns every problem found.
+func ValidateBranchProtectionPolicyData(fileData [][]string) []ValidationError {
+	var validationErrors []ValidationError
+
+	if len(fileData) == 0 {
+		return append(validationErrors, ValidationError{Message: "file is empty"})
+	}
+
+	header := fileData[0]
+	known := HeaderIndex(BranchRulesHeader)
+	seen := make(map[string]bool, len(header))
+	for _, name := range header {
+		name = strings.TrimSpace(name)
+		if _, ok := known[name]; !ok && !informationalColumns[name] && metadataColumns[name] == nil && !strings.HasPrefix(name, PropertyColumnPrefix) {
+			validationErrors = append(validationErrors, ValidationError{Row: 1, Column: name, Message: "unknown column"})
+		}
+		if seen[name] {
+			validationErrors = append(validationErrors, ValidationError{Row: 1, Column: name, Message: "duplicate column"})
+		}
+		seen[name] = true
+	}
+	for _, name := range requiredColumns {
+		if !seen[name] {
+			validationErrors = append(validationErrors, ValidationError{Row: 1, Column: name, Message: "missing column"})
+		}
+	}
+	if len(validationErrors) > 0 {
+		return validationErrors
+	}
+
+	col := HeaderIndex(header)
+	rules := make(map[string]int)
+	for i, each := range fileData[1:] {
+		row := i + 2
+		if len(each) != len(header) {
+			validationErrors = append(validationErrors, ValidationError{
+				Row:     row,
+				Message: fmt.Sprintf("expected %d fields, found %d", len(header), len(each)),
+			})
+			continue
+		}
+		for _, name := range append(append([]string{}, requiredColumns...), nonEmptyColumns...) {
+			if i, ok := col[name]; ok && strings.TrimSpace(each[i]) == "" {
+				validationErrors = append(validationErrors, ValidationError{Row: row, Column: name, Message: "value is required"})
+			}
+		}
+		for _, name := range booleanColumns {
+			if _, ok := col[name]; !ok {
+				continue
+			}
+			if !booleanValues[each[col[name]]] {
+				validationErrors = append(validationErrors, ValidationError{
+					Row:     row,
+					Column:  name,
+					Message: fmt.Sprintf("%q is not a boolean", each[col[name]]),
+				})
+			}
+		}
+		for _, name := range integerColumns {
+			if _, ok := col[name]; !ok {
+				continue
+			}
+			if n, err := strconv.Atoi(each[col[name]]); err != nil || n < 0 {
+				validationErrors = append(validationErrors, ValidationError{
+					Row:     row,
+					Column:  name,
+					Message: fmt.Sprintf("%q is not a non-negative integer", each[col[name]]),
+				})
+			}
+		}
+
+		// Rules are identified by their repository and pattern, or by their ID
+		// when the file leaves either out. Reports of several owners hold the
+		// same repository name once per owner
+		repoCol, hasRepo := col["RepositoryName"]
+		patternCol, hasPattern := col["BranchProtectionRulePattern"]
+		if !hasRepo || !hasPattern {
+			id := each[col["BranchProtectionRuleId"]]
+			if first, ok := rules[id]; ok {
+				validationErrors = append(validationErrors, ValidationError{
+					Row:     row,
+					Message: fmt.Sprintf("duplicate rule %s, first defined on row %d", id, first),
+				})
+			} else {
+				rules[id] = row
+			}
+			continue
+		}
+		repoName := each[repoCol]
+		if orgCol, ok := col["Organization"]; ok && each[orgCol] != "" {
+			repoName = each[orgCol] + "/" + repoName
+		}
+		key := repoName + "\x00" + each[patternCol]
+		if first, ok := rules[key]; ok {
+			validationErrors = append(validationErrors, ValidationError{
+				Row:     row,
+				Message: fmt.Sprintf("duplicate rule for %s pattern %q, first defined on row %d", repoName, each[patternCol], first),
+			})
+		} else {
+			rules[key] = row
+		}
+	}
+
+	return validationErrors
+}
+
+// ReadBranchRulesFile reads every record of a branch protection rules file.
+// Rows with a differing number of fields are returned as-is so that they can
+// be reported by ValidateBranchProtectionPolicyData.
+func ReadBranchRulesFile(fileName string) ([][]string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	csvReader := csv.NewReader(f)
+	csvReader.FieldsPerRecord = -1
+	return csvReader.ReadAll()
+}
@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+// ruleRow returns a valid row of BranchRulesHeader for a rule, with every
+// setting off.
+func ruleRow(repo string, pattern string, id string) []string {
+	col := HeaderIndex(BranchRulesHeader)
+	row := make([]string, len(BranchRulesHeader))
+	for _, name := range booleanColumns {
+		row[col[name]] = "false"
+	}
+	for _, name := range integerColumns {
+		row[col[name]] = "0"
+	}
+	row[col["RepositoryName"]] = repo
+	row[col["BranchProtectionRulePattern"]] = pattern
+	row[col["BranchProtectionRuleId"]] = id
+	return row
+}
+
+// withValue returns a copy of row with the column set to value.
+func withValue(row []string, column string, value string) []string {
+	row = append([]string{}, row...)
+	row[HeaderIndex(BranchRulesHeader)[column]] = value
+	return row
+}
+
+func TestValidateBranchProtectionPolicyData(t *testing.T) {
+	header := BranchRulesHeader
+	main := ruleRow("repo-a", "main", "BPR_1")
+
+	tests := []struct {
+		name     string
+		fileData [][]string
+		want     []ValidationError
+	}{
+		{
+			name:     "valid file",
+			fileData: [][]string{header, main, ruleRow("repo-a", "release/*", "BPR_2"), ruleRow("repo-b", "main", "BPR_3")},
+		},
+		{
+			name:     "empty file",
+			fileData: nil,
+			want:     []ValidationError{{Message: "file is empty"}},
+		},
+		{
+			name:     "bad boolean",
+			fileData: [][]string{header, withValue(main, "LockBranch", "yes")},
+			want:     []ValidationError{{Row: 2, Column: "LockBranch", Message: `"yes" is not a boolean`}},
+		},
+		{
+			name:     "numeric boolean",
+			fileData: [][]string{header, withValue(main, "LockBranch", "1")},
+			want:     []ValidationError{{Row: 2, Column: "LockBranch", Message: `"1" is not a boolean`}},
+		},
+		{
+			name:     "capitalized booleans",
+			fileData: [][]string{header, withValue(withValue(main, "LockBranch", "TRUE"), "AllowsDeletions", "False")},
+		},
+		{
+			name:     "negative integer",
+			fileData: [][]string{header, withValue(main, "RequiredApprovingReviewCount", "-1")},
+			want:     []ValidationError{{Row: 2, Column: "RequiredApprovingReviewCount", Message: `"-1" is not a non-negative integer`}},
+		},
+		{
+			name:     "duplicate repository and pattern",
+			fileData: [][]string{header, main, ruleRow("repo-a", "main", "BPR_2")},
+			want:     []ValidationError{{Row: 3, Message: `duplicate rule for repo-a pattern "main", first defined on row 2`}},
+		},
+		{
+			name: "same repository and pattern in different organizations",
+			fileData: [][]string{
+				append([]string{"Organization"}, header...),
+				append([]string{"org-a"}, main...),
+				append([]string{"org-b"}, ruleRow("repo-a", "main", "BPR_2")...),
+			},
+		},
+		{
+			name: "duplicate ID without pattern",
+			fileData: [][]string{
+				{"RepositoryName", "BranchProtectionRuleId"},
+				{"repo-a", "BPR_1"},
+				{"repo-b", "BPR_1"},
+			},
+			want: []ValidationError{{Row: 3, Message: "duplicate rule BPR_1, first defined on row 2"}},
+		},
+		{
+			name:     "unknown column",
+			fileData: [][]string{append(append([]string{}, header...), "Colour"), append(append([]string{}, main...), "blue")},
+			want:     []ValidationError{{Row: 1, Column: "Colour", Message: "unknown column"}},
+		},
+		{
+			name: "informational and property columns",
+			fileData: [][]string{
+				append(append([]string{}, header...), "OwningTeams", "Visibility", "Property.team"),
+				append(append([]string{}, main...), "admins", "private", "platform"),
+			},
+		},
+		{
+			name:     "missing ID column",
+			fileData: [][]string{{"RepositoryName", "LockBranch"}, {"repo-a", "true"}},
+			want:     []ValidationError{{Row: 1, Column: "BranchProtectionRuleId", Message: "missing column"}},
+		},
+		{
+			name:     "short row",
+			fileData: [][]string{header, main[:5]},
+			want:     []ValidationError{{Row: 2, Message: "expected 24 fields, found 5"}},
+		},
+		{
+			name:     "empty pattern",
+			fileData: [][]string{header, withValue(main, "BranchProtectionRulePattern", " ")},
+			want:     []ValidationError{{Row: 2, Column: "BranchProtectionRulePattern", Message: "value is required"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ValidateBranchProtectionPolicyData(tt.fileData)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateBranchProtectionPolicyData() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}